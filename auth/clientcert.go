@@ -0,0 +1,210 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package auth
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientCertificate is the certificate presented by the client to servers
+// that require mutual TLS. Exactly one of the following must be set:
+//
+//   - CertFile and KeyFile, the paths to the PEM-encoded certificate chain
+//     and private key;
+//   - PKCS12File (and PKCS12Password, if the bundle is protected), the path
+//     to a PKCS#12 bundle with the private key and certificate chain;
+//   - CertFile and Signer, the path to the PEM-encoded certificate chain and
+//     a crypto.Signer for the associated private key (e.g., backed by an HSM).
+//
+// The files are checked for changes on every TLS handshake, so that rotated
+// credentials are picked up without restarting the client.
+type ClientCertificate struct {
+	CertFile       string
+	KeyFile        string
+	PKCS12File     string
+	PKCS12Password string
+	Signer         crypto.Signer
+
+	mu     sync.Mutex
+	cert   *tls.Certificate
+	stamps map[string]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Validate checks that exactly one source of credentials is configured.
+func (o *ClientCertificate) Validate() error {
+	switch {
+	case o.PKCS12File != "":
+		if o.CertFile != "" || o.KeyFile != "" || o.Signer != nil {
+			return errors.New("a PKCS#12 bundle cannot be combined with other client credentials")
+		}
+	case o.CertFile == "":
+		return errors.New("missing client certificate")
+	case o.KeyFile != "" && o.Signer != nil:
+		return errors.New("only one of client key file or signer must be specified")
+	case o.KeyFile == "" && o.Signer == nil:
+		return errors.New("missing client key")
+	}
+
+	return nil
+}
+
+// Load returns the client certificate, (re)loading it from disk if this is
+// the first call or if any of the underlying files has changed since the
+// previous one. If a reload fails, the previously loaded certificate is
+// returned.
+func (o *ClientCertificate) Load() (*tls.Certificate, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stamps, err := o.stat()
+	if err != nil {
+		if o.cert != nil {
+			log.Printf("could not check client certificate files, using cached certificate: %v", err)
+			return o.cert, nil
+		}
+		return nil, err
+	}
+
+	if o.cert != nil && reflect.DeepEqual(stamps, o.stamps) {
+		return o.cert, nil
+	}
+
+	cert, err := o.load()
+	if err != nil {
+		if o.cert != nil {
+			log.Printf("could not reload client certificate, using cached certificate: %v", err)
+			return o.cert, nil
+		}
+		return nil, err
+	}
+
+	o.cert = cert
+	o.stamps = stamps
+
+	return cert, nil
+}
+
+// GetClientCertificate can be used as the homonymous tls.Config callback.
+func (o *ClientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return o.Load()
+}
+
+func (o *ClientCertificate) files() []string {
+	var files []string
+
+	for _, f := range []string{o.CertFile, o.KeyFile, o.PKCS12File} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+
+	return files
+}
+
+func (o *ClientCertificate) stat() (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+
+	for _, f := range o.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		stamps[f] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps, nil
+}
+
+func (o *ClientCertificate) load() (*tls.Certificate, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case o.PKCS12File != "":
+		return o.loadPKCS12()
+	case o.Signer != nil:
+		return o.loadWithSigner()
+	default:
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		return &cert, nil
+	}
+}
+
+func (o *ClientCertificate) loadPKCS12() (*tls.Certificate, error) {
+	data, err := os.ReadFile(o.PKCS12File)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	key, leaf, chain, err := pkcs12.DecodeChain(data, o.PKCS12Password)
+	if err != nil {
+		return nil, fmt.Errorf("decoding PKCS#12 bundle %s: %w", o.PKCS12File, err)
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return &cert, nil
+}
+
+func (o *ClientCertificate) loadWithSigner() (*tls.Certificate, error) {
+	data, err := os.ReadFile(o.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	var cert tls.Certificate
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", o.CertFile)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing client certificate: %w", err)
+	}
+
+	pub, ok := o.Signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(leaf.PublicKey) {
+		return nil, errors.New("client certificate does not match the signer's public key")
+	}
+
+	cert.Leaf = leaf
+	cert.PrivateKey = o.Signer
+
+	return &cert, nil
+}
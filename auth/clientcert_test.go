@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type testClientCreds struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestClientCreds(t *testing.T, cn string) testClientCreds {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testClientCreds{key: key, cert: cert}
+}
+
+func (o testClientCreds) writePEM(t *testing.T, certPath, keyPath string) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: o.cert.Raw})
+	require.NoError(t, os.WriteFile(certPath, certPEM, 0600))
+
+	if keyPath != "" {
+		der, err := x509.MarshalPKCS8PrivateKey(o.key)
+		require.NoError(t, err)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(keyPath, keyPEM, 0600))
+	}
+}
+
+func TestClientCertificate_Validate(t *testing.T) {
+	signer := crypto.Signer(newTestClientCreds(t, "client").key)
+
+	for _, tv := range []struct {
+		cc  *ClientCertificate
+		err string
+	}{
+		{&ClientCertificate{CertFile: "c", KeyFile: "k"}, ""},
+		{&ClientCertificate{PKCS12File: "p"}, ""},
+		{&ClientCertificate{CertFile: "c", Signer: signer}, ""},
+		{&ClientCertificate{}, "missing client certificate"},
+		{&ClientCertificate{CertFile: "c"}, "missing client key"},
+		{&ClientCertificate{CertFile: "c", KeyFile: "k", Signer: signer}, "only one of client key file or signer must be specified"},
+		{&ClientCertificate{PKCS12File: "p", KeyFile: "k"}, "a PKCS#12 bundle cannot be combined with other client credentials"},
+	} {
+		err := tv.cc.Validate()
+		if tv.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tv.err)
+		}
+	}
+}
+
+func TestClientCertificate_Load_PEM_reload(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+
+	first := newTestClientCreds(t, "first")
+	first.writePEM(t, certPath, keyPath)
+
+	cc := ClientCertificate{CertFile: certPath, KeyFile: keyPath}
+
+	cert, err := cc.Load()
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	// unchanged files are not reloaded
+	again, err := cc.Load()
+	require.NoError(t, err)
+	assert.Same(t, cert, again)
+
+	// rotate the credentials on disk
+	second := newTestClientCreds(t, "second")
+	second.writePEM(t, certPath, keyPath)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, future, future))
+	require.NoError(t, os.Chtimes(keyPath, future, future))
+
+	cert, err = cc.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+
+	// a broken rotation keeps the last good certificate
+	require.NoError(t, os.WriteFile(keyPath, []byte("garbage"), 0600))
+	cert, err = cc.Load()
+	require.NoError(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
+
+func TestClientCertificate_Load_PKCS12(t *testing.T) {
+	creds := newTestClientCreds(t, "client")
+
+	pfx, err := pkcs12.Modern.Encode(creds.key, creds.cert, nil, "s3cret")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "client.p12")
+	require.NoError(t, os.WriteFile(path, pfx, 0600))
+
+	cc := ClientCertificate{PKCS12File: path, PKCS12Password: "s3cret"}
+
+	cert, err := cc.Load()
+	require.NoError(t, err)
+	assert.Equal(t, creds.cert.Raw, cert.Certificate[0])
+
+	cc = ClientCertificate{PKCS12File: path, PKCS12Password: "wrong"}
+	_, err = cc.Load()
+	assert.ErrorContains(t, err, "decoding PKCS#12 bundle")
+}
+
+func TestClientCertificate_Load_Signer(t *testing.T) {
+	creds := newTestClientCreds(t, "client")
+
+	certPath := filepath.Join(t.TempDir(), "client.crt")
+	creds.writePEM(t, certPath, "")
+
+	cc := ClientCertificate{CertFile: certPath, Signer: creds.key}
+
+	cert, err := cc.Load()
+	require.NoError(t, err)
+	assert.Equal(t, creds.key, cert.PrivateKey)
+
+	other := newTestClientCreds(t, "other")
+	cc = ClientCertificate{CertFile: certPath, Signer: other.key}
+
+	_, err = cc.Load()
+	assert.EqualError(t, err, "client certificate does not match the signer's public key")
+}
+
+func TestNewTLSTransportWithOptions_mutual_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+
+	creds := newTestClientCreds(t, "client")
+	creds.writePEM(t, certPath, keyPath)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(creds.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Len(t, r.TLS.PeerCertificates, 1)
+		assert.Equal(t, "client", r.TLS.PeerCertificates[0].Subject.CommonName)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caPath := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0600))
+
+	// without a client certificate the handshake fails
+	transport, err := NewTLSTransport([]string{caPath})
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(srv.URL) // nolint: noctx
+	assert.Error(t, err)
+
+	transport, err = NewTLSTransportWithOptions(TLSOptions{
+		CACerts:    []string{caPath},
+		ClientCert: &ClientCertificate{CertFile: certPath, KeyFile: keyPath},
+	})
+	require.NoError(t, err)
+
+	res, err := (&http.Client{Transport: transport}).Get(srv.URL) // nolint: noctx
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	// broken client credentials are reported straight away
+	_, err = NewTLSTransportWithOptions(TLSOptions{
+		ClientCert: &ClientCertificate{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyPath},
+	})
+	assert.ErrorContains(t, err, "no such file or directory")
+}
+
+func TestOauth2_Configure_client_cert(t *testing.T) {
+	var oa2a Oauth2Authenticator
+
+	err := oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"grant_type":    "client_credentials",
+		"token_url":     "https://example.com",
+		"client_cert":   "/path/to/client.crt",
+		"client_key":    "/path/to/client.key",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, oa2a.ClientCert)
+	assert.Equal(t, "/path/to/client.crt", oa2a.ClientCert.CertFile)
+	assert.Equal(t, "/path/to/client.key", oa2a.ClientCert.KeyFile)
+
+	err = oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"grant_type":    "client_credentials",
+		"token_url":     "https://example.com",
+		"client_cert":   "/path/to/client.crt",
+	})
+	assert.EqualError(t, err, "invalid client certificate: missing client key")
+}
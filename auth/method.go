@@ -6,7 +6,8 @@ package auth
 import "fmt"
 
 // Method is the enumeration of authentication methods supported by Veraison
-// service. It implements the pflag.Value interface.
+// service. Additional methods can be added with Register. It implements the
+// pflag.Value interface.
 type Method string
 
 const (
@@ -30,7 +31,11 @@ func (o *Method) Set(v string) error {
 	case "oauth2":
 		*o = MethodOauth2
 	default:
-		return fmt.Errorf("unexpected Method %q", v)
+		// methods added via Register are selected by their name
+		if !isRegistered(Method(v)) {
+			return fmt.Errorf("unexpected Method %q", v)
+		}
+		*o = Method(v)
 	}
 
 	return nil
@@ -6,47 +6,126 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 )
 
+// GrantType is the OAuth2 grant used by Oauth2Authenticator to obtain tokens.
+type GrantType string
+
+const (
+	// GrantPassword is the resource-owner password credentials grant
+	// (RFC 6749, Section 4.3). This is the default.
+	GrantPassword GrantType = "password"
+	// GrantClientCredentials is the client credentials grant (RFC 6749,
+	// Section 4.4), suitable for machine identities.
+	GrantClientCredentials GrantType = "client_credentials"
+)
+
+// DefaultOauth2Scopes are requested when no scopes are configured.
+var DefaultOauth2Scopes = []string{"openid"}
+
 type Oauth2Authenticator struct {
 	TokenURL     string
+	Issuer       string // when set instead of TokenURL, the token endpoint is obtained via OIDC discovery
 	ClientID     string
 	ClientSecret string
 	Username     string
 	Password     string
 	CACerts      []string
+	GrantType    GrantType          // defaults to GrantPassword if empty
+	Scopes       []string           // defaults to DefaultOauth2Scopes if empty
+	Audience     string             // optional "audience" parameter (client_credentials only)
+	ExtraParams  map[string]string  // optional additional token request parameters (client_credentials only)
+	ExpirySkew   time.Duration      // refresh tokens this long before they expire (if zero, 10s is used)
+	TokenStore   ITokenStore        // when set, tokens are loaded from and saved to TokenStore
+	ClientCert   *ClientCertificate // when set, presented to the authorization server for mutual TLS
 
+	// Token seeds the token cache. After the first call to EncodeHeader it
+	// is kept up to date with the last token obtained, and must not be
+	// accessed concurrently with EncodeHeader.
 	Token *oauth2.Token
+
+	mu        sync.Mutex            // guards Token, src and refresher
+	src       oauth2.TokenSource    // caching, concurrency-safe source of tokens
+	refresher *oauth2TokenRefresher // the refresher backing src
 }
 
 func (o *Oauth2Authenticator) Configure(cfg map[string]interface{}) error {
 	decoded := struct {
 		TokenURL     string                 `mapstructure:"token_url" valid:"url"`
+		Issuer       string                 `mapstructure:"issuer" valid:"url"`
 		ClientID     string                 `mapstructure:"client_id"`
 		ClientSecret string                 `mapstructure:"client_secret"`
 		Username     string                 `mapstructure:"username"`
 		Password     string                 `mapstructure:"password"`
 		CACerts      []string               `mapstructure:"ca_certs"`
+		GrantType    string                 `mapstructure:"grant_type"`
+		Scopes       []string               `mapstructure:"scopes"`
+		Audience     string                 `mapstructure:"audience"`
+		ExtraParams  map[string]string      `mapstructure:"extra_params"`
+		ExpirySkew   time.Duration          `mapstructure:"expiry_skew"`
+		TokenCache   string                 `mapstructure:"token_cache"`
+		ClientCert   string                 `mapstructure:"client_cert"`
+		ClientKey    string                 `mapstructure:"client_key"`
+		ClientPKCS12 string                 `mapstructure:"client_pkcs12"`
+		PKCS12Pass   string                 `mapstructure:"client_pkcs12_password"`
 		Rest         map[string]interface{} `mapstructure:",remain"`
 	}{}
 
-	if err := mapstructure.Decode(cfg, &decoded); err != nil {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &decoded,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(cfg); err != nil {
 		return err
 	}
 
 	o.ClientID = decoded.ClientID
 	o.ClientSecret = decoded.ClientSecret
 	o.TokenURL = decoded.TokenURL
+	o.Issuer = decoded.Issuer
 	o.Username = decoded.Username
 	o.Password = decoded.Password
 	o.CACerts = decoded.CACerts
+	o.GrantType = GrantType(decoded.GrantType)
+	o.Scopes = decoded.Scopes
+	o.Audience = decoded.Audience
+	o.ExtraParams = decoded.ExtraParams
+	o.ExpirySkew = decoded.ExpirySkew
+
+	if decoded.TokenCache != "" {
+		o.TokenStore = NewFileTokenStore(decoded.TokenCache)
+	}
+
+	o.ClientCert = nil
+	if decoded.ClientCert != "" || decoded.ClientKey != "" || decoded.ClientPKCS12 != "" {
+		o.ClientCert = &ClientCertificate{
+			CertFile:       decoded.ClientCert,
+			KeyFile:        decoded.ClientKey,
+			PKCS12File:     decoded.ClientPKCS12,
+			PKCS12Password: decoded.PKCS12Pass,
+		}
+	}
+
+	// discard any token obtained with the previous configuration
+	o.mu.Lock()
+	o.Token = nil
+	o.src = nil
+	o.refresher = nil
+	o.mu.Unlock()
 
 	if err := o.validate(); err != nil {
 		return err
@@ -65,37 +144,126 @@ func (o *Oauth2Authenticator) Configure(cfg map[string]interface{}) error {
 }
 
 func (o *Oauth2Authenticator) EncodeHeader() (string, error) {
-	var err error
+	tok, err := o.TokenSource().Token()
+	if err != nil {
+		return "", err
+	}
 
-	if o.Token == nil || o.Token.Expiry.Before(time.Now()) {
-		o.Token, err = o.obtainToken()
-		if err != nil {
-			return "", err
+	header := fmt.Sprintf("Bearer %s", tok.AccessToken)
+
+	return header, nil
+}
+
+// TokenSource returns the oauth2.TokenSource backing the authenticator. The
+// returned source is safe for concurrent use: a cached token is returned
+// until it is within ExpirySkew of its expiry, at which point a single caller
+// refreshes it (using the refresh token, if one was issued) while the others
+// wait for the result. If a TokenStore is configured, the cache is seeded
+// from it and every new token is written back to it.
+func (o *Oauth2Authenticator) TokenSource() oauth2.TokenSource {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.src == nil {
+		if o.Token == nil && o.TokenStore != nil {
+			tok, err := o.TokenStore.Load(o.tokenStoreKey())
+			if err != nil {
+				log.Printf("could not load cached OAuth2 token: %v", err)
+			}
+			o.Token = tok
 		}
+
+		o.refresher = &oauth2TokenRefresher{o: o, last: o.Token}
+		o.src = oauth2.ReuseTokenSourceWithExpiry(o.Token, o.refresher, o.ExpirySkew)
 	}
 
-	header := fmt.Sprintf("Bearer %s", o.Token.AccessToken)
+	return o.src
+}
 
-	return header, nil
+// oauth2TokenRefresher is the oauth2.TokenSource invoked by the caching
+// source when the current token is no longer valid. Calls are serialized by
+// the caching source.
+type oauth2TokenRefresher struct {
+	o    *Oauth2Authenticator
+	last *oauth2.Token
 }
 
-func (o *Oauth2Authenticator) obtainToken() (*oauth2.Token, error) {
-	if err := o.validate(); err != nil {
+func (r *oauth2TokenRefresher) Token() (*oauth2.Token, error) {
+	var (
+		tok *oauth2.Token
+		err error
+	)
+
+	if r.last != nil && r.last.RefreshToken != "" {
+		tok, err = r.o.refreshToken(r.last.RefreshToken)
+	}
+
+	// if there is no refresh token, or it has been rejected, go through the
+	// configured grant again
+	if tok == nil || err != nil {
+		if tok, err = r.o.obtainToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	r.last = tok
+
+	// a token obtained with a configuration that has since been replaced
+	// is handed to the caller that asked for it, but not cached
+	r.o.mu.Lock()
+	current := r.o.refresher == r
+	if current {
+		r.o.Token = tok
+	}
+	r.o.mu.Unlock()
+
+	if current && r.o.TokenStore != nil {
+		if err := r.o.TokenStore.Save(r.o.tokenStoreKey(), tok); err != nil {
+			log.Printf("could not cache OAuth2 token: %v", err)
+		}
+	}
+
+	return tok, nil
+}
+
+func (o *Oauth2Authenticator) tokenStoreKey() string {
+	tokenURL := o.TokenURL
+	if tokenURL == "" {
+		tokenURL = o.Issuer
+	}
+
+	return TokenStoreKey(tokenURL, o.ClientID, o.Username)
+}
+
+func (o *Oauth2Authenticator) refreshToken(refreshToken string) (*oauth2.Token, error) {
+	ctx, err := o.httpContext()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenURL, err := o.tokenURL()
+	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
 	conf := &oauth2.Config{
 		ClientID:     o.ClientID,
 		ClientSecret: o.ClientSecret,
-		Scopes:       []string{"openid"},
 		Endpoint: oauth2.Endpoint{
-			TokenURL: o.TokenURL,
+			TokenURL: tokenURL,
 		},
 	}
 
-	if len(o.CACerts) > 0 {
-		transport, err := NewTLSTransport(o.CACerts)
+	return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+}
+
+// httpContext returns the context carrying the HTTP client used for token
+// requests
+func (o *Oauth2Authenticator) httpContext() (context.Context, error) {
+	ctx := context.Background()
+
+	if len(o.CACerts) > 0 || o.ClientCert != nil {
+		transport, err := NewTLSTransportWithOptions(o.tlsOptions())
 		if err != nil {
 			return nil, err
 		}
@@ -103,9 +271,105 @@ func (o *Oauth2Authenticator) obtainToken() (*oauth2.Token, error) {
 		ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
 	}
 
+	return ctx, nil
+}
+
+// tlsOptions returns the TLS options for connections to the authorization
+// server, used for both discovery and token requests
+func (o *Oauth2Authenticator) tlsOptions() TLSOptions {
+	return TLSOptions{CACerts: o.CACerts, ClientCert: o.ClientCert}
+}
+
+func (o *Oauth2Authenticator) obtainToken() (*oauth2.Token, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, err := o.httpContext()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenURL, err := o.tokenURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.grantType() == GrantClientCredentials {
+		conf := &clientcredentials.Config{
+			ClientID:       o.ClientID,
+			ClientSecret:   o.ClientSecret,
+			TokenURL:       tokenURL,
+			Scopes:         o.scopes(),
+			EndpointParams: o.endpointParams(),
+		}
+
+		return conf.Token(ctx)
+	}
+
+	conf := &oauth2.Config{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		Scopes:       o.scopes(),
+		Endpoint: oauth2.Endpoint{
+			TokenURL: tokenURL,
+		},
+	}
+
 	return conf.PasswordCredentialsToken(ctx, o.Username, o.Password)
 }
 
+// tokenURL returns the configured token URL or, if an issuer is configured
+// instead, the token endpoint advertised by the issuer's OIDC discovery
+// document
+func (o *Oauth2Authenticator) tokenURL() (string, error) {
+	if o.TokenURL != "" {
+		return o.TokenURL, nil
+	}
+
+	doc, err := DiscoverOIDCWithOptions(o.Issuer, o.tlsOptions())
+	if err != nil {
+		return "", err
+	}
+
+	if !doc.SupportsGrant(o.grantType()) {
+		return "", fmt.Errorf(
+			"issuer %q does not support the %s grant (supported: %s)",
+			o.Issuer, o.grantType(), strings.Join(doc.GrantTypesSupported, ", "),
+		)
+	}
+
+	return doc.TokenEndpoint, nil
+}
+
+func (o *Oauth2Authenticator) grantType() GrantType {
+	if o.GrantType == "" {
+		return GrantPassword
+	}
+	return o.GrantType
+}
+
+func (o *Oauth2Authenticator) scopes() []string {
+	if len(o.Scopes) == 0 {
+		return DefaultOauth2Scopes
+	}
+	return o.Scopes
+}
+
+func (o *Oauth2Authenticator) endpointParams() url.Values {
+	params := url.Values{}
+
+	for k, v := range o.ExtraParams {
+		params.Set(k, v)
+	}
+
+	if o.Audience != "" {
+		params.Set("audience", o.Audience)
+	}
+
+	return params
+}
+
 func (o *Oauth2Authenticator) validate() error {
 	if o.ClientID == "" {
 		return errors.New("missing client_id")
@@ -115,20 +379,47 @@ func (o *Oauth2Authenticator) validate() error {
 		return errors.New("missing client_secret")
 	}
 
-	if o.TokenURL == "" {
-		return errors.New("missing token_url")
+	switch {
+	case o.TokenURL == "" && o.Issuer == "":
+		return errors.New("missing token_url or issuer")
+	case o.TokenURL != "" && o.Issuer != "":
+		return errors.New("only one of token_url or issuer must be specified")
+	case o.TokenURL != "":
+		if _, err := url.Parse(o.TokenURL); err != nil {
+			return fmt.Errorf("invalid token_url: %w", err)
+		}
+	default:
+		if _, err := url.Parse(o.Issuer); err != nil {
+			return fmt.Errorf("invalid issuer: %w", err)
+		}
 	}
 
-	if _, err := url.Parse(o.TokenURL); err != nil {
-		return fmt.Errorf("invalid token_url: %w", err)
+	if o.ClientCert != nil {
+		if err := o.ClientCert.Validate(); err != nil {
+			return fmt.Errorf("invalid client certificate: %w", err)
+		}
 	}
 
-	if o.Username == "" {
-		return errors.New("missing username")
-	}
+	switch o.grantType() {
+	case GrantPassword:
+		if o.Username == "" {
+			return errors.New("missing username")
+		}
 
-	if o.Password == "" {
-		return errors.New("missing password")
+		if o.Password == "" {
+			return errors.New("missing password")
+		}
+
+		if o.Audience != "" || len(o.ExtraParams) > 0 {
+			return fmt.Errorf(
+				"audience and extra_params are only supported with the %s grant",
+				GrantClientCredentials,
+			)
+		}
+	case GrantClientCredentials:
+		// client ID and secret are all that is needed
+	default:
+		return fmt.Errorf("unsupported grant_type %q", o.GrantType)
 	}
 
 	return nil
@@ -1,10 +1,17 @@
 package auth
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
 )
 
 func TestOauth2_Configure(t *testing.T) {
@@ -50,3 +57,286 @@ func TestOauth2_Configure(t *testing.T) {
 	})
 	assert.EqualError(t, err, "unexpected fields in config: full name")
 }
+
+func TestOauth2_Configure_client_credentials(t *testing.T) {
+	var oa2a Oauth2Authenticator
+
+	err := oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"token_url":     "http://example.com",
+		"grant_type":    "client_credentials",
+		"scopes":        []string{"veraison:provision", "veraison:manage"},
+		"audience":      "veraison",
+		"extra_params": map[string]interface{}{
+			"resource": "https://veraison.example",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, GrantClientCredentials, oa2a.GrantType)
+	assert.Equal(t, []string{"veraison:provision", "veraison:manage"}, oa2a.Scopes)
+	assert.Equal(t, "veraison", oa2a.Audience)
+	assert.Equal(t, map[string]string{"resource": "https://veraison.example"}, oa2a.ExtraParams)
+
+	err = oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"token_url":     "http://example.com",
+		"grant_type":    "implicit",
+	})
+	assert.EqualError(t, err, `unsupported grant_type "implicit"`)
+
+	err = oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"username":      "user1",
+		"password":      "Passw0rd!",
+		"token_url":     "http://example.com",
+		"audience":      "veraison",
+	})
+	assert.EqualError(t, err, "audience and extra_params are only supported with the client_credentials grant")
+}
+
+func newTestTokenServer(t *testing.T, check func(form url.Values)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		check(r.PostForm)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":300}`))
+		require.NoError(t, err)
+	}))
+}
+
+func TestOauth2_EncodeHeader_password(t *testing.T) {
+	srv := newTestTokenServer(t, func(form url.Values) {
+		assert.Equal(t, "password", form.Get("grant_type"))
+		assert.Equal(t, "user1", form.Get("username"))
+		assert.Equal(t, "Passw0rd!", form.Get("password"))
+		assert.Equal(t, "openid", form.Get("scope"))
+	})
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		Username:     "user1",
+		Password:     "Passw0rd!",
+		TokenURL:     srv.URL,
+	}
+
+	header, err := oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t0ken", header)
+}
+
+func TestOauth2_EncodeHeader_client_credentials(t *testing.T) {
+	srv := newTestTokenServer(t, func(form url.Values) {
+		assert.Equal(t, "client_credentials", form.Get("grant_type"))
+		assert.Empty(t, form.Get("username"))
+		assert.Equal(t, "veraison:provision", form.Get("scope"))
+		assert.Equal(t, "veraison", form.Get("audience"))
+		assert.Equal(t, "https://veraison.example", form.Get("resource"))
+	})
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		TokenURL:     srv.URL,
+		GrantType:    GrantClientCredentials,
+		Scopes:       []string{"veraison:provision"},
+		Audience:     "veraison",
+		ExtraParams:  map[string]string{"resource": "https://veraison.example"},
+	}
+
+	header, err := oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t0ken", header)
+}
+
+func TestOauth2_Configure_expiry_skew(t *testing.T) {
+	var oa2a Oauth2Authenticator
+
+	err := oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"token_url":     "http://example.com",
+		"grant_type":    "client_credentials",
+		"expiry_skew":   "30s",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, oa2a.ExpirySkew)
+
+	err = oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"token_url":     "http://example.com",
+		"grant_type":    "client_credentials",
+		"expiry_skew":   "soon",
+	})
+	assert.ErrorContains(t, err, "invalid duration")
+}
+
+func TestOauth2_EncodeHeader_refresh_token(t *testing.T) {
+	var grants []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		grants = append(grants, r.PostForm.Get("grant_type"))
+
+		body := `{"access_token":"t0ken","refresh_token":"r1","token_type":"Bearer","expires_in":60}`
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			assert.Equal(t, "r1", r.PostForm.Get("refresh_token"))
+			body = `{"access_token":"t1ken","token_type":"Bearer","expires_in":60}`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		Username:     "user1",
+		Password:     "Passw0rd!",
+		TokenURL:     srv.URL,
+		// with a skew larger than the token lifetime, every token is
+		// considered stale as soon as it is obtained
+		ExpirySkew: 2 * time.Minute,
+	}
+
+	header, err := oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t0ken", header)
+
+	header, err = oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t1ken", header)
+
+	// the refresh token is carried over when the server does not rotate it
+	header, err = oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t1ken", header)
+
+	assert.Equal(t, []string{"password", "refresh_token", "refresh_token"}, grants)
+	assert.Equal(t, "r1", oa2a.Token.RefreshToken)
+}
+
+func TestOauth2_EncodeHeader_refresh_token_rejected(t *testing.T) {
+	var grants []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		grants = append(grants, r.PostForm.Get("grant_type"))
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, err := w.Write([]byte(`{"error":"invalid_grant"}`))
+			require.NoError(t, err)
+			return
+		}
+
+		_, err := w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":60}`))
+		require.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		Username:     "user1",
+		Password:     "Passw0rd!",
+		TokenURL:     srv.URL,
+		Token: &oauth2.Token{
+			AccessToken:  "expired",
+			RefreshToken: "stale",
+			Expiry:       time.Now().Add(-time.Minute),
+		},
+	}
+
+	header, err := oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t0ken", header)
+	// the oauth2 package may retry the rejected refresh with a different
+	// client authentication style before giving up
+	require.GreaterOrEqual(t, len(grants), 2)
+	assert.Equal(t, "refresh_token", grants[0])
+	assert.Equal(t, "password", grants[len(grants)-1])
+}
+
+func TestOauth2_EncodeHeader_concurrent(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		// widen the window for concurrent refreshes
+		time.Sleep(50 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":300}`))
+		assert.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		TokenURL:     srv.URL,
+		GrantType:    GrantClientCredentials,
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				header, err := oa2a.EncodeHeader()
+				assert.NoError(t, err)
+				assert.Equal(t, "Bearer t0ken", header)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestOauth2_Configure_discards_stale_refresh(t *testing.T) {
+	srv := newTestTokenServer(t, func(form url.Values) {})
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		TokenURL:     srv.URL,
+		GrantType:    GrantClientCredentials,
+	}
+
+	stale := oa2a.TokenSource()
+
+	require.NoError(t, oa2a.Configure(map[string]interface{}{
+		"client_id":     "otherclient",
+		"client_secret": "cafebabe",
+		"token_url":     srv.URL,
+		"grant_type":    "client_credentials",
+	}))
+
+	// a refresh through the source of the previous configuration completes,
+	// but must not be cached by the reconfigured authenticator
+	tok, err := stale.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "t0ken", tok.AccessToken)
+	assert.Nil(t, oa2a.Token)
+
+	_, err = oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.NotNil(t, oa2a.Token)
+}
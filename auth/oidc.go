@@ -0,0 +1,165 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCDiscoveryPath is the path, relative to the issuer URL, of the OpenID
+// Connect discovery document.
+const OIDCDiscoveryPath = "/.well-known/openid-configuration"
+
+// OIDCProviderMetadata is the subset of the OpenID Provider Metadata (OpenID
+// Connect Discovery 1.0, Section 3) used by Oauth2Authenticator.
+type OIDCProviderMetadata struct {
+	Issuer              string   `json:"issuer"`
+	TokenEndpoint       string   `json:"token_endpoint"`
+	GrantTypesSupported []string `json:"grant_types_supported,omitempty"`
+}
+
+// SupportsGrant returns true if the provider advertises support for the
+// supplied grant type. Providers that do not advertise their supported grant
+// types are assumed to support any.
+func (o OIDCProviderMetadata) SupportsGrant(g GrantType) bool {
+	if len(o.GrantTypesSupported) == 0 {
+		return true
+	}
+
+	for _, s := range o.GrantTypesSupported {
+		if s == string(g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// oidcCache maps each issuer and trust configuration to the discovery
+// document fetched with it. The global lock only guards the map: each entry
+// has its own lock, held while fetching, so that a slow issuer does not hold
+// up the discovery of the others, and concurrent discoveries of the same
+// issuer result in a single fetch.
+var oidcCache = struct {
+	sync.Mutex
+	entries map[string]*oidcCacheEntry
+}{entries: map[string]*oidcCacheEntry{}}
+
+type oidcCacheEntry struct {
+	mu  sync.Mutex
+	doc *OIDCProviderMetadata
+}
+
+// DiscoverOIDC fetches the OpenID Connect discovery document of the supplied
+// issuer, trusting the specified CA certs in addition to the system ones.
+// Documents are cached for the lifetime of the process.
+func DiscoverOIDC(issuer string, caCerts []string) (*OIDCProviderMetadata, error) {
+	return DiscoverOIDCWithOptions(issuer, TLSOptions{CACerts: caCerts})
+}
+
+// DiscoverOIDCWithOptions is like DiscoverOIDC, but connects to the issuer
+// with the supplied TLS options. Documents are cached per issuer and server
+// trust configuration (CACerts, PinnedKeys and Insecure), so that a document
+// obtained under one trust configuration is never handed out under another.
+// Failed discoveries are not cached.
+func DiscoverOIDCWithOptions(issuer string, opts TLSOptions) (*OIDCProviderMetadata, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	key := oidcCacheKey(issuer, opts)
+
+	oidcCache.Lock()
+	entry, ok := oidcCache.entries[key]
+	if !ok {
+		entry = &oidcCacheEntry{}
+		oidcCache.entries[key] = entry
+	}
+	oidcCache.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.doc != nil {
+		return entry.doc, nil
+	}
+
+	doc, err := fetchOIDCProviderMetadata(issuer, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.doc = doc
+
+	return doc, nil
+}
+
+func oidcCacheKey(issuer string, opts TLSOptions) string {
+	caCerts := append([]string(nil), opts.CACerts...)
+	sort.Strings(caCerts)
+
+	pins := append([]string(nil), opts.PinnedKeys...)
+	sort.Strings(pins)
+
+	return strings.Join([]string{
+		issuer,
+		strings.Join(caCerts, ","),
+		strings.Join(pins, ","),
+		strconv.FormatBool(opts.Insecure),
+	}, "\x00")
+}
+
+func fetchOIDCProviderMetadata(issuer string, opts TLSOptions) (*OIDCProviderMetadata, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+
+	if len(opts.CACerts) > 0 || len(opts.PinnedKeys) > 0 || opts.Insecure ||
+		opts.ClientCert != nil || opts.VerifyPeerCertificate != nil {
+		transport, err := NewTLSTransportWithOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+
+	uri := issuer + OIDCDiscoveryPath
+
+	req, err := http.NewRequest("GET", uri, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery: GET %q returned %s", uri, res.Status)
+	}
+
+	var doc OIDCProviderMetadata
+
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: decoding %q: %w", uri, err)
+	}
+
+	// OpenID Connect Discovery 1.0, Section 4.3
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf(
+			"OIDC discovery: issuer mismatch: expected %q, got %q", issuer, doc.Issuer,
+		)
+	}
+
+	if doc.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OIDC discovery: no token_endpoint in %q", uri)
+	}
+
+	return &doc, nil
+}
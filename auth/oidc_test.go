@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIssuer returns a TLS server acting as both an OIDC issuer and its
+// token endpoint, together with the path to a file containing its CA cert.
+func newTestIssuer(t *testing.T, grants string) (*httptest.Server, string, *int) {
+	return newTestIssuerWithTLS(t, grants, nil)
+}
+
+// newTestIssuerWithTLS is like newTestIssuer, but the server uses the supplied
+// TLS config, if any
+func newTestIssuerWithTLS(t *testing.T, grants string, cfg *tls.Config) (*httptest.Server, string, *int) {
+	discoveries := 0
+
+	var srv *httptest.Server
+
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/realms/veraison" + OIDCDiscoveryPath:
+			discoveries++
+			doc := fmt.Sprintf(
+				`{"issuer":"%[1]s/realms/veraison","token_endpoint":"%[1]s/realms/veraison/token","grant_types_supported":%s}`,
+				srv.URL, grants,
+			)
+			_, err := w.Write([]byte(doc))
+			require.NoError(t, err)
+		case "/realms/veraison/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+			_, err := w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":300}`))
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+
+	certPath := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(certPath, certPEM, 0600))
+
+	return srv, certPath, &discoveries
+}
+
+func TestOauth2_Configure_issuer(t *testing.T) {
+	var oa2a Oauth2Authenticator
+
+	err := oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"grant_type":    "client_credentials",
+		"issuer":        "https://kc.example/realms/veraison",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://kc.example/realms/veraison", oa2a.Issuer)
+
+	err = oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"grant_type":    "client_credentials",
+		"issuer":        "https://kc.example/realms/veraison",
+		"token_url":     "https://kc.example/realms/veraison/token",
+	})
+	assert.EqualError(t, err, "only one of token_url or issuer must be specified")
+
+	err = oa2a.Configure(map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"grant_type":    "client_credentials",
+	})
+	assert.EqualError(t, err, "missing token_url or issuer")
+}
+
+func TestOauth2_EncodeHeader_issuer(t *testing.T) {
+	srv, certPath, discoveries := newTestIssuer(t, `["client_credentials","password"]`)
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		oa2a := Oauth2Authenticator{
+			ClientID:     "myclient",
+			ClientSecret: "deadbeef",
+			GrantType:    GrantClientCredentials,
+			Issuer:       srv.URL + "/realms/veraison/",
+			CACerts:      []string{certPath},
+		}
+
+		header, err := oa2a.EncodeHeader()
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer t0ken", header)
+	}
+
+	// the discovery document is cached
+	assert.Equal(t, 1, *discoveries)
+}
+
+func TestOauth2_EncodeHeader_issuer_unsupported_grant(t *testing.T) {
+	srv, certPath, _ := newTestIssuer(t, `["authorization_code","password"]`)
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		GrantType:    GrantClientCredentials,
+		Issuer:       srv.URL + "/realms/veraison",
+		CACerts:      []string{certPath},
+	}
+
+	_, err := oa2a.EncodeHeader()
+	assert.EqualError(t, err, fmt.Sprintf(
+		"issuer %q does not support the client_credentials grant (supported: authorization_code, password)",
+		srv.URL+"/realms/veraison",
+	))
+}
+
+func TestDiscoverOIDC_issuer_mismatch(t *testing.T) {
+	srv, certPath, _ := newTestIssuer(t, `[]`)
+	defer srv.Close()
+
+	_, err := DiscoverOIDC(srv.URL+"/realms/other", []string{certPath})
+	assert.ErrorContains(t, err, "returned 404 Not Found")
+
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"issuer":"https://elsewhere.example","token_endpoint":"https://elsewhere.example/token"}`))
+		require.NoError(t, err)
+	}))
+	defer srv2.Close()
+
+	_, err = DiscoverOIDC(srv2.URL, nil)
+	assert.EqualError(t, err, fmt.Sprintf(
+		`OIDC discovery: issuer mismatch: expected %q, got "https://elsewhere.example"`, srv2.URL,
+	))
+}
+
+func TestDiscoverOIDC_cache_keyed_on_trust(t *testing.T) {
+	srv, certPath, discoveries := newTestIssuer(t, `[]`)
+	defer srv.Close()
+
+	issuer := srv.URL + "/realms/veraison"
+
+	_, err := DiscoverOIDC(issuer, []string{certPath})
+	require.NoError(t, err)
+
+	// a document fetched trusting certPath is not returned to a caller
+	// that does not trust it
+	_, err = DiscoverOIDC(issuer, nil)
+	assert.ErrorContains(t, err, "certificate")
+
+	_, err = DiscoverOIDC(issuer, []string{certPath})
+	require.NoError(t, err)
+	assert.Equal(t, 1, *discoveries)
+}
+
+func TestDiscoverOIDC_slow_issuer(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+
+	var slow *httptest.Server
+
+	slow = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		_, err := fmt.Fprintf(w, `{"issuer":%q,"token_endpoint":"%[1]s/token"}`, slow.URL)
+		assert.NoError(t, err)
+	}))
+	defer slow.Close()
+
+	fast, certPath, _ := newTestIssuer(t, `[]`)
+	defer fast.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := DiscoverOIDC(slow.URL, nil)
+		done <- err
+	}()
+
+	<-received
+
+	// the discovery of another issuer is not held up
+	_, err := DiscoverOIDC(fast.URL+"/realms/veraison", []string{certPath})
+	assert.NoError(t, err)
+
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestOauth2_EncodeHeader_issuer_mutual_TLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCertPath := filepath.Join(dir, "client.crt")
+	clientKeyPath := filepath.Join(dir, "client.key")
+
+	creds := newTestClientCreds(t, "client")
+	creds.writePEM(t, clientCertPath, clientKeyPath)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(creds.cert)
+
+	srv, certPath, discoveries := newTestIssuerWithTLS(t, `["client_credentials"]`, &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	})
+	defer srv.Close()
+
+	oa2a := Oauth2Authenticator{
+		ClientID:     "myclient",
+		ClientSecret: "deadbeef",
+		GrantType:    GrantClientCredentials,
+		Issuer:       srv.URL + "/realms/veraison",
+		CACerts:      []string{certPath},
+		ClientCert:   &ClientCertificate{CertFile: clientCertPath, KeyFile: clientKeyPath},
+	}
+
+	header, err := oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer t0ken", header)
+	assert.Equal(t, 1, *discoveries)
+}
+
+func TestOIDCProviderMetadata_SupportsGrant(t *testing.T) {
+	doc := OIDCProviderMetadata{}
+	assert.True(t, doc.SupportsGrant(GrantPassword))
+
+	doc.GrantTypesSupported = []string{"password"}
+	assert.True(t, doc.SupportsGrant(GrantPassword))
+	assert.False(t, doc.SupportsGrant(GrantClientCredentials))
+}
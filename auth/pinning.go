@@ -0,0 +1,129 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SPKIPinPrefix is the optional prefix of public key pins, as used by curl's
+// --pinnedpubkey and by HTTP Public Key Pinning.
+const SPKIPinPrefix = "sha256/"
+
+// VerifyPeerCertificateFunc has the same signature as the homonymous
+// tls.Config callback. It receives the raw ASN.1 certificates presented by
+// the server and, if standard verification took place, the verified chains.
+type VerifyPeerCertificateFunc func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+// SPKIPin returns the pin of the supplied certificate, i.e., the base64
+// encoded SHA-256 digest of its DER-encoded SubjectPublicKeyInfo, prefixed
+// with SPKIPinPrefix.
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return SPKIPinPrefix + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// ParseSPKIPins decodes the supplied public key pins. Each pin is the base64
+// encoded SHA-256 digest of a DER-encoded SubjectPublicKeyInfo, optionally
+// prefixed with SPKIPinPrefix.
+func ParseSPKIPins(pins []string) ([][]byte, error) {
+	digests := make([][]byte, 0, len(pins))
+
+	for _, pin := range pins {
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, SPKIPinPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key pin %q: %w", pin, err)
+		}
+
+		if len(digest) != sha256.Size {
+			return nil, fmt.Errorf(
+				"invalid public key pin %q: expecting a %d bytes digest, got %d",
+				pin, sha256.Size, len(digest),
+			)
+		}
+
+		digests = append(digests, digest)
+	}
+
+	return digests, nil
+}
+
+type spkiPinner struct {
+	digests [][]byte
+
+	// roots are the CAs, in addition to the pinned ones presented by the
+	// server, used to build the chains checked against the pins. They are
+	// not trusted on their own.
+	roots *x509.CertPool
+}
+
+func (o spkiPinner) matches(cert *x509.Certificate) bool {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	for _, d := range o.digests {
+		if subtle.ConstantTimeCompare(d, digest[:]) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyConnection accepts the server if the key of its certificate is
+// pinned, or if its certificate can be verified up to a root via a chain that
+// includes a certificate whose key is pinned. Chains are built from the
+// certificates presented by the server and from the roots, so a pinned CA is
+// matched whether or not the server sends it. In the latter case, the server
+// name is also checked.
+func (o spkiPinner) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate to check against the pinned keys")
+	}
+
+	leaf := cs.PeerCertificates[0]
+
+	if o.matches(leaf) {
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	if o.roots != nil {
+		roots = o.roots.Clone()
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, c := range cs.PeerCertificates[1:] {
+		if o.matches(c) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err == nil {
+		for _, chain := range chains {
+			for _, c := range chain[1:] {
+				if o.matches(c) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf(
+		"server certificate %q does not match any of the pinned keys", leaf.Subject,
+	)
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPinningTestServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func getWithOptions(t *testing.T, uri string, opts TLSOptions) error {
+	transport, err := NewTLSTransportWithOptions(opts)
+	require.NoError(t, err)
+
+	res, err := (&http.Client{Transport: transport}).Get(uri) // nolint: noctx
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+func TestParseSPKIPins(t *testing.T) {
+	creds := newTestClientCreds(t, "server")
+	pin := SPKIPin(creds.cert)
+
+	assert.Regexp(t, `^sha256/[A-Za-z0-9+/]{43}=$`, pin)
+
+	digests, err := ParseSPKIPins([]string{pin, pin[len(SPKIPinPrefix):]})
+	require.NoError(t, err)
+	require.Len(t, digests, 2)
+	assert.Equal(t, digests[0], digests[1])
+
+	_, err = ParseSPKIPins([]string{"sha256/!!!"})
+	assert.ErrorContains(t, err, `invalid public key pin "sha256/!!!"`)
+
+	_, err = ParseSPKIPins([]string{"sha256/AAAA"})
+	assert.EqualError(t, err, `invalid public key pin "sha256/AAAA": expecting a 32 bytes digest, got 3`)
+}
+
+func TestNewTLSTransportWithOptions_pinned_self_signed(t *testing.T) {
+	srv := newPinningTestServer(t)
+
+	// the self-signed server cert is not trusted by default
+	assert.Error(t, getWithOptions(t, srv.URL, TLSOptions{}))
+
+	pin := SPKIPin(srv.Certificate())
+	assert.NoError(t, getWithOptions(t, srv.URL, TLSOptions{PinnedKeys: []string{pin}}))
+
+	other := SPKIPin(newTestClientCreds(t, "other").cert)
+	err := getWithOptions(t, srv.URL, TLSOptions{PinnedKeys: []string{other}})
+	assert.ErrorContains(t, err, "does not match any of the pinned keys")
+
+	_, err = NewTLSTransportWithOptions(TLSOptions{PinnedKeys: []string{"bad"}})
+	assert.ErrorContains(t, err, `invalid public key pin "bad"`)
+}
+
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testClientCreds) testClientCreds {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer, signerCert := key, tmpl
+	if parent != nil {
+		signer, signerCert = parent.key, parent.cert
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signer)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testClientCreds{key: key, cert: cert}
+}
+
+// newCATestServer returns a TLS server whose certificate is issued by the
+// returned CA. The server only sends the CA cert along with its own if sendCA
+// is true.
+func newCATestServer(t *testing.T, sendCA bool) (*httptest.Server, testClientCreds) {
+	ca := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pinned CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}, nil)
+
+	server := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}, &ca)
+
+	chain := [][]byte{server.cert.Raw}
+	if sendCA {
+		chain = append(chain, ca.cert.Raw)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: chain,
+			PrivateKey:  server.key,
+		}},
+		MinVersion: tls.VersionTLS12,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv, ca
+}
+
+func TestNewTLSTransportWithOptions_pinned_CA(t *testing.T) {
+	srv, ca := newCATestServer(t, true)
+
+	pin := SPKIPin(ca.cert)
+	assert.NoError(t, getWithOptions(t, srv.URL, TLSOptions{PinnedKeys: []string{pin}}))
+
+	// a pinned CA does not vouch for other server names
+	uri := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	err := getWithOptions(t, uri, TLSOptions{PinnedKeys: []string{pin}})
+	assert.ErrorContains(t, err, "does not match any of the pinned keys")
+}
+
+func TestNewTLSTransportWithOptions_pinned_CA_not_sent(t *testing.T) {
+	srv, ca := newCATestServer(t, false)
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	ca.writePEM(t, caPath, "")
+
+	pin := SPKIPin(ca.cert)
+
+	// the pinned CA is neither sent by the server nor otherwise known
+	err := getWithOptions(t, srv.URL, TLSOptions{PinnedKeys: []string{pin}})
+	assert.ErrorContains(t, err, "does not match any of the pinned keys")
+
+	// the chain is completed with CACerts
+	assert.NoError(t, getWithOptions(t, srv.URL, TLSOptions{
+		PinnedKeys: []string{pin},
+		CACerts:    []string{caPath},
+	}))
+
+	// CACerts are only used to build the chain, not trusted on their own
+	other := newPinningTestServer(t)
+	err = getWithOptions(t, srv.URL, TLSOptions{
+		PinnedKeys: []string{SPKIPin(other.Certificate())},
+		CACerts:    []string{caPath},
+	})
+	assert.ErrorContains(t, err, "does not match any of the pinned keys")
+}
+
+func TestNewTLSTransportWithOptions_VerifyPeerCertificate(t *testing.T) {
+	srv := newPinningTestServer(t)
+
+	var seen [][]byte
+
+	opts := TLSOptions{
+		PinnedKeys: []string{SPKIPin(srv.Certificate())},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			seen = rawCerts
+			return nil
+		},
+	}
+
+	require.NoError(t, getWithOptions(t, srv.URL, opts))
+	require.Len(t, seen, 1)
+	assert.Equal(t, srv.Certificate().Raw, seen[0])
+
+	opts.VerifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+		return errors.New("rejected by policy")
+	}
+
+	assert.ErrorContains(t, getWithOptions(t, srv.URL, opts), "rejected by policy")
+
+	// the hook is not called if the pinned keys do not match
+	called := false
+	opts.PinnedKeys = []string{SPKIPin(newTestClientCreds(t, "other").cert)}
+	opts.VerifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+		called = true
+		return nil
+	}
+
+	assert.Error(t, getWithOptions(t, srv.URL, opts))
+	assert.False(t, called)
+}
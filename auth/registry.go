@@ -0,0 +1,94 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory returns a new, not yet configured, IAuthenticator.
+type Factory func() IAuthenticator
+
+var registry = struct {
+	sync.RWMutex
+	factories map[Method]Factory
+}{
+	factories: map[Method]Factory{
+		MethodPassthrough: func() IAuthenticator { return &NullAuthenticator{} },
+		MethodBasic:       func() IAuthenticator { return &BasicAuthenticator{} },
+		MethodOauth2:      func() IAuthenticator { return &Oauth2Authenticator{} },
+	},
+}
+
+// Register makes the IAuthenticator returned by f available under the
+// supplied Method, so that it can be selected by name (e.g., via Method.Set)
+// and instantiated with New. It is an error to register the same Method
+// twice.
+func Register(method Method, f Factory) error {
+	if method == "" {
+		return errors.New("empty authentication method")
+	}
+
+	if f == nil {
+		return fmt.Errorf("nil factory for authentication method %q", method)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.factories[method]; ok {
+		return fmt.Errorf("authentication method %q already registered", method)
+	}
+
+	registry.factories[method] = f
+
+	return nil
+}
+
+// New instantiates the IAuthenticator registered for the supplied Method and
+// configures it with cfg.
+func New(method Method, cfg map[string]interface{}) (IAuthenticator, error) {
+	registry.RLock()
+	f, ok := registry.factories[method]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unexpected Method %q", method)
+	}
+
+	a := f()
+
+	if err := a.Configure(cfg); err != nil {
+		return nil, fmt.Errorf("configuring %s authenticator: %w", method, err)
+	}
+
+	return a, nil
+}
+
+// RegisteredMethods returns the sorted list of Methods that can be passed to
+// New.
+func RegisteredMethods() []Method {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	methods := make([]Method, 0, len(registry.factories))
+	for m := range registry.factories {
+		methods = append(methods, m)
+	}
+
+	sort.Slice(methods, func(i, j int) bool { return methods[i] < methods[j] })
+
+	return methods
+}
+
+func isRegistered(method Method) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	_, ok := registry.factories[method]
+
+	return ok
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTokenAuthenticator struct {
+	Token string
+}
+
+func (o *testTokenAuthenticator) Configure(cfg map[string]interface{}) error {
+	tok, ok := cfg["token"].(string)
+	if !ok {
+		return assert.AnError
+	}
+	o.Token = tok
+	return nil
+}
+
+func (o *testTokenAuthenticator) EncodeHeader() (string, error) {
+	return "Token " + o.Token, nil
+}
+
+func TestNew_builtin(t *testing.T) {
+	a, err := New(MethodPassthrough, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &NullAuthenticator{}, a)
+
+	a, err = New(MethodBasic, map[string]interface{}{
+		"username": "user1",
+		"password": "Passw0rd!",
+	})
+	require.NoError(t, err)
+	require.IsType(t, &BasicAuthenticator{}, a)
+	assert.Equal(t, "user1", a.(*BasicAuthenticator).Username)
+
+	_, err = New(MethodBasic, map[string]interface{}{"username": "user1"})
+	assert.EqualError(t, err, "configuring basic authenticator: missing password")
+
+	a, err = New(MethodOauth2, map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"grant_type":    "client_credentials",
+		"token_url":     "http://example.com",
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &Oauth2Authenticator{}, a)
+
+	_, err = New(Method("kerberos"), nil)
+	assert.EqualError(t, err, `unexpected Method "kerberos"`)
+}
+
+func TestRegister(t *testing.T) {
+	method := Method("test-token")
+
+	var m Method
+	assert.EqualError(t, m.Set("test-token"), `unexpected Method "test-token"`)
+
+	err := Register(method, func() IAuthenticator { return &testTokenAuthenticator{} })
+	require.NoError(t, err)
+
+	err = Register(method, func() IAuthenticator { return &testTokenAuthenticator{} })
+	assert.EqualError(t, err, `authentication method "test-token" already registered`)
+
+	err = Register(MethodBasic, func() IAuthenticator { return &testTokenAuthenticator{} })
+	assert.EqualError(t, err, `authentication method "basic" already registered`)
+
+	err = Register("", func() IAuthenticator { return &testTokenAuthenticator{} })
+	assert.EqualError(t, err, "empty authentication method")
+
+	err = Register(Method("other"), nil)
+	assert.EqualError(t, err, `nil factory for authentication method "other"`)
+
+	require.NoError(t, m.Set("test-token"))
+	assert.Equal(t, method, m)
+
+	a, err := New(m, map[string]interface{}{"token": "s3cret"})
+	require.NoError(t, err)
+
+	header, err := a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "Token s3cret", header)
+
+	assert.Contains(t, RegisteredMethods(), method)
+	assert.Contains(t, RegisteredMethods(), MethodOauth2)
+}
+
+func TestMethod_Set(t *testing.T) {
+	var m Method
+
+	require.NoError(t, m.Set("none"))
+	assert.Equal(t, MethodPassthrough, m)
+
+	require.NoError(t, m.Set("oauth2"))
+	assert.Equal(t, MethodOauth2, m)
+	assert.Equal(t, "oauth2", m.String())
+	assert.Equal(t, "Method", m.Type())
+}
@@ -10,9 +10,107 @@ import (
 	"os"
 )
 
+// TLSOptions collects the TLS settings used for connections to Veraison
+// services and to authorization servers.
+type TLSOptions struct {
+	// CACerts are the paths to CA certs to be trusted in addition to the
+	// system ones.
+	CACerts []string
+
+	// ClientCert, if set, is presented to servers requesting mutual TLS.
+	ClientCert *ClientCertificate
+
+	// Insecure disables the verification of the server's certificate.
+	Insecure bool
+
+	// PinnedKeys, if set, are the SPKI pins (see SPKIPin) of the keys the
+	// server is trusted with. The server is accepted if its certificate's
+	// key is pinned, or if its certificate verifies up to a root via a chain
+	// that includes a certificate whose key is pinned. The chain is built
+	// from the certificates presented by the server, the system CAs and
+	// CACerts, so that a pinned CA is matched even if the server does not
+	// send it; those CAs are not otherwise trusted. This allows talking to
+	// servers with self-signed certificates without disabling verification
+	// altogether.
+	PinnedKeys []string
+
+	// VerifyPeerCertificate, if set, is called after the standard (or
+	// pinned) verification of the server's certificate has succeeded, and
+	// can reject the connection by returning an error.
+	VerifyPeerCertificate VerifyPeerCertificateFunc
+}
+
 // NewTLSTransport returns a pointer to a new http.Transport with TLS config
 // initilaized with system certs as well as specified certPaths.
 func NewTLSTransport(certPaths []string) (*http.Transport, error) {
+	return NewTLSTransportWithOptions(TLSOptions{CACerts: certPaths})
+}
+
+// NewTLSTransportWithOptions returns a pointer to a new http.Transport with
+// TLS config initialized according to the supplied options.
+func NewTLSTransportWithOptions(opts TLSOptions) (*http.Transport, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	switch {
+	case len(opts.PinnedKeys) > 0:
+		digests, err := ParseSPKIPins(opts.PinnedKeys)
+		if err != nil {
+			return nil, err
+		}
+		roots, err := newCertPool(opts.CACerts)
+		if err != nil {
+			return nil, err
+		}
+		// the chain is checked against the pinned keys in VerifyConnection
+		cfg.InsecureSkipVerify = true // nolint: gosec
+		cfg.VerifyConnection = spkiPinner{digests: digests, roots: roots}.verifyConnection
+	case opts.Insecure:
+		cfg.InsecureSkipVerify = true // nolint: gosec
+	default:
+		certPool, err := newCertPool(opts.CACerts)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = certPool
+	}
+
+	if opts.ClientCert != nil {
+		// fail early if the client credentials cannot be loaded
+		if _, err := opts.ClientCert.Load(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = opts.ClientCert.GetClientCertificate
+	}
+
+	if opts.VerifyPeerCertificate != nil {
+		verify := opts.VerifyPeerCertificate
+		pinned := cfg.VerifyConnection
+
+		// run the hook once the pinned keys have been checked
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if pinned != nil {
+				if err := pinned(cs); err != nil {
+					return err
+				}
+			}
+
+			rawCerts := make([][]byte, 0, len(cs.PeerCertificates))
+			for _, c := range cs.PeerCertificates {
+				rawCerts = append(rawCerts, c.Raw)
+			}
+
+			return verify(rawCerts, cs.VerifiedChains)
+		}
+	}
+
+	return &http.Transport{TLSClientConfig: cfg}, nil
+}
+
+// newCertPool returns the system cert pool extended with the certs in the
+// supplied files
+func newCertPool(certPaths []string) (*x509.CertPool, error) {
 	certPool, err := x509.SystemCertPool()
 	if err != nil {
 		return nil, err
@@ -29,10 +127,5 @@ func NewTLSTransport(certPaths []string) (*http.Transport, error) {
 		}
 	}
 
-	return &http.Transport{
-		TLSClientConfig: &tls.Config{
-			RootCAs:    certPool,
-			MinVersion: tls.VersionTLS12,
-		},
-	}, nil
+	return certPool, nil
 }
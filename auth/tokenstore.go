@@ -0,0 +1,127 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ITokenStore persists OAuth2 tokens across processes, so that short-lived
+// clients do not need to go through a full grant every time they start.
+type ITokenStore interface {
+	// Load returns the token stored under key, or nil if there is none.
+	Load(key string) (*oauth2.Token, error)
+	// Save stores tok under key, replacing any previous token.
+	Save(key string, tok *oauth2.Token) error
+}
+
+// TokenStoreKey returns the key under which tokens obtained from tokenURL
+// for the specified client and user are stored.
+func TokenStoreKey(tokenURL, clientID, username string) string {
+	h := sha256.Sum256([]byte(tokenURL + "\n" + clientID + "\n" + username))
+	return hex.EncodeToString(h[:])
+}
+
+// FileTokenStore is an ITokenStore backed by a JSON file that is only
+// accessible by its owner. Multiple keys can be stored in the same file.
+type FileTokenStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileTokenStore returns a FileTokenStore using the file at path. The file
+// is created on the first Save.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+func (o *FileTokenStore) Load(key string) (*oauth2.Token, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tokens, err := o.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens[key], nil
+}
+
+func (o *FileTokenStore) Save(key string, tok *oauth2.Token) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tokens, err := o.read()
+	if err != nil {
+		return err
+	}
+
+	tokens[key] = tok
+
+	return o.write(tokens)
+}
+
+func (o *FileTokenStore) read() (map[string]*oauth2.Token, error) {
+	tokens := map[string]*oauth2.Token{}
+
+	data, err := os.ReadFile(o.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return tokens, nil
+		}
+		return nil, fmt.Errorf("reading token store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("decoding token store %s: %w", o.Path, err)
+	}
+
+	return tokens, nil
+}
+
+// write atomically replaces the store file, so that concurrent readers never
+// observe a partially written file
+func (o *FileTokenStore) write(tokens map[string]*oauth2.Token) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("encoding token store: %w", err)
+	}
+
+	dir := filepath.Dir(o.Path)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating token store directory: %w", err)
+	}
+
+	// CreateTemp creates the file with 0600 permissions
+	tmp, err := os.CreateTemp(dir, filepath.Base(o.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing token store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing token store: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing token store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), o.Path); err != nil {
+		return fmt.Errorf("writing token store: %w", err)
+	}
+
+	return nil
+}
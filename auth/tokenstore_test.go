@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenStore_LoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "tokens.json")
+	store := NewFileTokenStore(path)
+
+	tok, err := store.Load("key1")
+	require.NoError(t, err)
+	assert.Nil(t, tok)
+
+	expiry := time.Now().Add(time.Hour).Round(0).UTC()
+
+	err = store.Save("key1", &oauth2.Token{AccessToken: "t0ken", Expiry: expiry})
+	require.NoError(t, err)
+
+	err = store.Save("key2", &oauth2.Token{AccessToken: "t1ken", RefreshToken: "r1"})
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// a different store instance sees the same tokens
+	store = NewFileTokenStore(path)
+
+	tok, err = store.Load("key1")
+	require.NoError(t, err)
+	require.NotNil(t, tok)
+	assert.Equal(t, "t0ken", tok.AccessToken)
+	assert.True(t, expiry.Equal(tok.Expiry))
+
+	tok, err = store.Load("key2")
+	require.NoError(t, err)
+	require.NotNil(t, tok)
+	assert.Equal(t, "r1", tok.RefreshToken)
+}
+
+func TestFileTokenStore_Load_corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+
+	_, err := NewFileTokenStore(path).Load("key1")
+	assert.ErrorContains(t, err, "decoding token store")
+}
+
+func TestTokenStoreKey(t *testing.T) {
+	k1 := TokenStoreKey("https://kc.example/token", "client", "user1")
+	k2 := TokenStoreKey("https://kc.example/token", "client", "user2")
+
+	assert.NotEqual(t, k1, k2)
+	assert.Equal(t, k1, TokenStoreKey("https://kc.example/token", "client", "user1"))
+}
+
+func TestOauth2_EncodeHeader_token_cache(t *testing.T) {
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":300}`))
+		require.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	cfg := map[string]interface{}{
+		"client_id":     "myclient",
+		"client_secret": "deadbeef",
+		"username":      "user1",
+		"password":      "Passw0rd!",
+		"token_url":     srv.URL,
+		"token_cache":   filepath.Join(t.TempDir(), "tokens.json"),
+	}
+
+	// simulate two short-lived processes sharing the cache
+	for i := 0; i < 2; i++ {
+		var oa2a Oauth2Authenticator
+		require.NoError(t, oa2a.Configure(cfg))
+
+		header, err := oa2a.EncodeHeader()
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer t0ken", header)
+	}
+
+	assert.Equal(t, 1, requests)
+
+	// a different user does not pick up the cached token
+	cfg["username"] = "user2"
+
+	var oa2a Oauth2Authenticator
+	require.NoError(t, oa2a.Configure(cfg))
+
+	_, err := oa2a.EncodeHeader()
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
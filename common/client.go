@@ -5,6 +5,7 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -16,10 +17,12 @@ import (
 
 // Client holds configuration data associated with the HTTP(s) session, and a
 // reference to an IAuthenticator that is used to provide Authorization headers
-// for requests.
+// for requests. If Retry is set, idempotent requests that fail for transient
+// reasons are retried according to it.
 type Client struct {
 	HTTPClient http.Client
 	Auth       auth.IAuthenticator
+	Retry      *RetryPolicy
 }
 
 // NewClient instantiates a new Client with a fixed 5s timeout. The client will
@@ -48,7 +51,15 @@ func NewInsecureTLSClient(a auth.IAuthenticator) *Client {
 // The client will use the provided IAuthenticator for requests, if it is not
 // nil.
 func NewTLSClient(a auth.IAuthenticator, certPaths []string) (*Client, error) {
-	transport, err := auth.NewTLSTransport(certPaths)
+	return NewTLSClientWithOptions(a, auth.TLSOptions{CACerts: certPaths})
+}
+
+// NewTLSClientWithOptions instantiates a new Client with a fixed 5s timeout
+// and transport configured according to the supplied TLS options (e.g., to
+// present a client certificate). The client will use the provided
+// IAuthenticator for requests, if it is not nil.
+func NewTLSClientWithOptions(a auth.IAuthenticator, opts auth.TLSOptions) (*Client, error) {
+	transport, err := auth.NewTLSTransportWithOptions(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +67,16 @@ func NewTLSClient(a auth.IAuthenticator, certPaths []string) (*Client, error) {
 	return NewClientWithTransport(a, transport), nil
 }
 
+// NewPinnedTLSClient instantiates a new Client with a fixed 5s timeout and
+// transport that only accepts servers whose public key, or that of a CA in
+// their certificate chain, matches one of the supplied SPKI pins (see
+// auth.SPKIPin). Pinned CAs are matched whether they are sent by the server or
+// found among the system CAs. The client will use the provided IAuthenticator
+// for requests, if it is not nil.
+func NewPinnedTLSClient(a auth.IAuthenticator, pins []string) (*Client, error) {
+	return NewTLSClientWithOptions(a, auth.TLSOptions{PinnedKeys: pins})
+}
+
 // NewClientWithTransport instantiates a new Client with the specified transport and a fixed
 // 5s timeout. The client will use the provided IAuthenticator for requests, if
 // it is not nil.
@@ -69,8 +90,25 @@ func NewClientWithTransport(a auth.IAuthenticator, transport http.RoundTripper)
 	}
 }
 
+// SetRetryPolicy enables retries of transient failures according to the
+// supplied RetryPolicy.
+func (c *Client) SetRetryPolicy(p RetryPolicy) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("invalid retry policy: %w", err)
+	}
+	c.Retry = &p
+	return nil
+}
+
+// DeleteResource issues a DELETE request against the supplied URI.
 func (c Client) DeleteResource(uri string) error {
-	req, err := c.newRequest("DELETE", uri, http.NoBody)
+	return c.DeleteResourceContext(context.Background(), uri)
+}
+
+// DeleteResourceContext is like DeleteResource but binds the request to the
+// supplied context.
+func (c Client) DeleteResourceContext(ctx context.Context, uri string) error {
+	req, err := c.newRequest(ctx, "DELETE", uri, http.NoBody)
 	if err != nil {
 		return fmt.Errorf("DELETE %q, request creation failed: %w", uri, err)
 	}
@@ -80,17 +118,26 @@ func (c Client) DeleteResource(uri string) error {
 		return err
 	}
 
+	defer res.Body.Close()
+
 	// Acceptable response codes are 200, 202 and 204
-	switch res.StatusCode {
-	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
-		return nil
-	default:
-		return fmt.Errorf("DELETE %q, response has unexpected status: %s", uri, res.Status)
-	}
+	return CheckResponse(res, http.StatusOK, http.StatusAccepted, http.StatusNoContent)
 }
 
+// PostResource POSTs the supplied body with content type ct to the supplied
+// URI, asking for a response of the accept media type.
 func (c Client) PostResource(body []byte, ct, accept, uri string) (*http.Response, error) {
-	req, err := c.newRequest("POST", uri, bytes.NewBuffer(body))
+	return c.PostResourceContext(context.Background(), body, ct, accept, uri)
+}
+
+// PostResourceContext is like PostResource but binds the request to the
+// supplied context.
+func (c Client) PostResourceContext(
+	ctx context.Context,
+	body []byte,
+	ct, accept, uri string,
+) (*http.Response, error) {
+	req, err := c.newRequest(ctx, "POST", uri, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("POST %q, request creation failed: %w", uri, err)
 	}
@@ -101,8 +148,19 @@ func (c Client) PostResource(body []byte, ct, accept, uri string) (*http.Respons
 	return c.send(req)
 }
 
+// PostEmptyResource POSTs an empty body to the supplied URI, asking for a
+// response of the accept media type.
 func (c Client) PostEmptyResource(accept, uri string) (*http.Response, error) {
-	req, err := c.newRequest("POST", uri, http.NoBody)
+	return c.PostEmptyResourceContext(context.Background(), accept, uri)
+}
+
+// PostEmptyResourceContext is like PostEmptyResource but binds the request to
+// the supplied context.
+func (c Client) PostEmptyResourceContext(
+	ctx context.Context,
+	accept, uri string,
+) (*http.Response, error) {
+	req, err := c.newRequest(ctx, "POST", uri, http.NoBody)
 	if err != nil {
 		return nil, fmt.Errorf("POST %q, request creation failed: %w", uri, err)
 	}
@@ -112,10 +170,21 @@ func (c Client) PostEmptyResource(accept, uri string) (*http.Response, error) {
 	return c.send(req)
 }
 
+// GetResource GETs the supplied URI, asking for a response of the accept
+// media type.
 func (c Client) GetResource(accept, uri string) (*http.Response, error) {
-	req, err := c.newRequest("GET", uri, http.NoBody)
+	return c.GetResourceContext(context.Background(), accept, uri)
+}
+
+// GetResourceContext is like GetResource but binds the request to the
+// supplied context.
+func (c Client) GetResourceContext(
+	ctx context.Context,
+	accept, uri string,
+) (*http.Response, error) {
+	req, err := c.newRequest(ctx, "GET", uri, http.NoBody)
 	if err != nil {
-		return nil, fmt.Errorf("POST %q, request creation failed: %w", uri, err)
+		return nil, fmt.Errorf("GET %q, request creation failed: %w", uri, err)
 	}
 
 	req.Header.Set("Accept", accept)
@@ -123,8 +192,40 @@ func (c Client) GetResource(accept, uri string) (*http.Response, error) {
 	return c.send(req)
 }
 
-func (c Client) newRequest(method, uri string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, uri, body)
+// GetResourceIfNoneMatch is like GetResource, but makes the request
+// conditional on the resource no longer matching the supplied entity tag. The
+// server answers 304 (Not Modified) if it still does. An empty etag results in
+// an unconditional request.
+func (c Client) GetResourceIfNoneMatch(accept, etag, uri string) (*http.Response, error) {
+	return c.GetResourceIfNoneMatchContext(context.Background(), accept, etag, uri)
+}
+
+// GetResourceIfNoneMatchContext is like GetResourceIfNoneMatch but binds the
+// request to the supplied context.
+func (c Client) GetResourceIfNoneMatchContext(
+	ctx context.Context,
+	accept, etag, uri string,
+) (*http.Response, error) {
+	req, err := c.newRequest(ctx, "GET", uri, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("GET %q, request creation failed: %w", uri, err)
+	}
+
+	req.Header.Set("Accept", accept)
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	return c.send(req)
+}
+
+func (c Client) newRequest(
+	ctx context.Context,
+	method, uri string,
+	body io.Reader,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
 	if err != nil {
 		return nil, err
 	}
@@ -139,10 +240,18 @@ func (c Client) newRequest(method, uri string, body io.Reader) (*http.Request, e
 		}
 	}
 
+	if key := idempotencyKeyFromContext(ctx); key != "" && method == "POST" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
 	return req, nil
 }
 
 func (c Client) send(req *http.Request) (*http.Response, error) {
+	if c.Retry != nil && isIdempotent(req) {
+		return c.sendWithRetry(req, *c.Retry)
+	}
+
 	hc := &c.HTTPClient
 
 	res, err := hc.Do(req)
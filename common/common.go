@@ -4,14 +4,19 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
-// TODO(tho) make these two configurable
+// PollPeriod and MaxAttempts are the legacy polling parameters.
+//
+// Deprecated: polling is now configured via PollPolicy; PollPeriod is only
+// used as the InitialDelay of DefaultPollPolicy.
 const (
 	PollPeriod  = 1 * time.Second
 	MaxAttempts = 2
@@ -48,6 +53,30 @@ func DecodeJSONBody(res *http.Response, j interface{}) error {
 	return json.NewDecoder(res.Body).Decode(&j)
 }
 
+// RetryAfter returns the delay requested by the server via the Retry-After
+// header of the supplied response. Both the delay-seconds and the HTTP-date
+// forms are supported. Zero is returned if the header is absent or malformed.
+// The delay is returned as requested: Poller caps it according to its
+// PollPolicy.
+func RetryAfter(res *http.Response) time.Duration {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
 // Extract Location header and resolve it to the supplied base (if non-empty)
 func ExtractLocation(res *http.Response, base string) (string, error) {
 	var err error
@@ -65,3 +94,42 @@ func ExtractLocation(res *http.Response, base string) (string, error) {
 
 	return loc, nil
 }
+
+// Sleep pauses for the duration d or until ctx is done, whichever comes first.
+// If ctx is done before d elapses, the context error is returned.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// CleanupTimeout bounds the requests that release server-side resources
+// after the operation they belong to is over.
+const CleanupTimeout = 10 * time.Second
+
+// WithoutCancel returns a context that carries the values of ctx but is never
+// canceled, and has no deadline, when ctx is. It is the equivalent of
+// context.WithoutCancel, which requires Go 1.21, and is meant for cleanup
+// requests that must go through even if the context of the operation that
+// needs them has been canceled.
+func WithoutCancel(ctx context.Context) context.Context {
+	return withoutCancelCtx{ctx}
+}
+
+type withoutCancelCtx struct {
+	parent context.Context
+}
+
+func (withoutCancelCtx) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (withoutCancelCtx) Done() <-chan struct{}       { return nil }
+func (withoutCancelCtx) Err() error                  { return nil }
+
+func (o withoutCancelCtx) Value(key interface{}) interface{} {
+	return o.parent.Value(key)
+}
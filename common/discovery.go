@@ -0,0 +1,111 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+const (
+	// DiscoveryMediaType is the media type of the well-known discovery
+	// documents of the Veraison services
+	DiscoveryMediaType = "application/vnd.veraison.discovery+json"
+
+	// ServiceStateReady is the service state advertised by a service that
+	// is ready to accept requests
+	ServiceStateReady = "READY"
+)
+
+// ServiceInfo models the fields shared by the well-known discovery documents
+// of the Veraison services
+type ServiceInfo struct {
+	MediaTypes   []string          `json:"media-types"`
+	Version      string            `json:"version"`
+	ServiceState string            `json:"service-state"`
+	APIEndpoints map[string]string `json:"api-endpoints"`
+}
+
+// IsReady returns true if the service advertises itself as ready
+func (o ServiceInfo) IsReady() bool {
+	return o.ServiceState == ServiceStateReady
+}
+
+// SupportsMediaType returns true if the service accepts the supplied media
+// type, ignoring differences in case, whitespace and parameter order
+func (o ServiceInfo) SupportsMediaType(mediaType string) bool {
+	return SupportsMediaType(o.MediaTypes, mediaType)
+}
+
+// Endpoint returns the absolute URI of the named API endpoint, resolving the
+// advertised path against baseURI
+func (o ServiceInfo) Endpoint(name, baseURI string) (string, error) {
+	path, ok := o.APIEndpoints[name]
+	if !ok || path == "" {
+		return "", fmt.Errorf("endpoint %q not advertised by the service", name)
+	}
+
+	return ResolveReference(baseURI, path)
+}
+
+// GetServiceInfoContext fetches the discovery document at uri using the
+// supplied client, and decodes it into info, which is either a *ServiceInfo or
+// a pointer to a struct embedding ServiceInfo
+func GetServiceInfoContext(ctx context.Context, client *Client, uri string, info interface{}) error {
+	if client == nil {
+		return errors.New("no client supplied")
+	}
+
+	res, err := client.GetResourceContext(ctx, DiscoveryMediaType, uri)
+	if err != nil {
+		return fmt.Errorf("service discovery failed: %w", err)
+	}
+
+	if err := CheckResponse(res, http.StatusOK); err != nil {
+		return err
+	}
+
+	if err := DecodeJSONBody(res, info); err != nil {
+		return fmt.Errorf("decoding discovery document: %w", err)
+	}
+
+	return nil
+}
+
+// SupportsMediaType looks for mediaType in supported, using SameMediaType
+func SupportsMediaType(supported []string, mediaType string) bool {
+	for _, mt := range supported {
+		if SameMediaType(mt, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// SameMediaType returns true if a and b denote the same media type, ignoring
+// differences in case, whitespace and parameter order. Media types that
+// cannot be parsed are compared verbatim.
+func SameMediaType(a, b string) bool {
+	ta, pa, errA := mime.ParseMediaType(a)
+	tb, pb, errB := mime.ParseMediaType(b)
+
+	if errA != nil || errB != nil {
+		return a == b
+	}
+
+	if ta != tb || len(pa) != len(pb) {
+		return false
+	}
+
+	for k, v := range pa {
+		if pb[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameMediaType(t *testing.T) {
+	for _, tv := range []struct {
+		a, b string
+		same bool
+	}{
+		{"application/json", "application/json", true},
+		{"Application/JSON", "application/json", true},
+		{`a/b; x="1"; y=2`, `a/b;y=2;x=1`, true},
+		{`a/b; x=1`, `a/b`, false},
+		{`a/b; x=1`, `a/b; x=2`, false},
+		{"a/b", "a/c", false},
+		{"not a media type", "not a media type", true},
+		{"not a media type", "a/b", false},
+	} {
+		assert.Equal(t, tv.same, SameMediaType(tv.a, tv.b), "%q vs %q", tv.a, tv.b)
+	}
+}
+
+func TestServiceInfo(t *testing.T) {
+	info := ServiceInfo{
+		MediaTypes:   []string{`application/eat-cwt; profile="http://arm.com/psa/2.0.0"`},
+		ServiceState: ServiceStateReady,
+		APIEndpoints: map[string]string{"submit": "/v1/submit"},
+	}
+
+	assert.True(t, info.IsReady())
+	assert.True(t, info.SupportsMediaType(`application/eat-cwt;profile="http://arm.com/psa/2.0.0"`))
+	assert.False(t, info.SupportsMediaType("application/eat-cwt"))
+
+	uri, err := info.Endpoint("submit", "https://veraison.example/base/")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://veraison.example/v1/submit", uri)
+
+	_, err = info.Endpoint("missing", "https://veraison.example")
+	assert.EqualError(t, err, `endpoint "missing" not advertised by the service`)
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrPollExhausted is returned by Poller.Wait when the attempts or the time
+// budget of the associated PollPolicy have been used up.
+var ErrPollExhausted = errors.New("polling budget exhausted")
+
+// jitterRand is the source of the poll delay jitter. The global math/rand
+// source is not seeded before Go 1.20, which would make every client jitter
+// its polls identically; *rand.Rand is not safe for concurrent use, hence the
+// mutex.
+var (
+	jitterRand   = rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+	jitterRandMu sync.Mutex
+)
+
+// MaxRetryAfter bounds the delay requested via Retry-After that is honoured
+// by a Poller whose policy has no MaxDelay.
+const MaxRetryAfter = time.Minute
+
+// PollPolicy describes how the state of an asynchronous session resource is
+// polled until it moves out of the "processing" state.
+//
+// The first poll happens as soon as the session resource is created, unless
+// the server asked to wait using a Retry-After header. The delay between
+// successive polls starts at InitialDelay and is multiplied by Multiplier after
+// each poll, up to MaxDelay. A Retry-After header in a poll response takes
+// precedence over the computed delay, but is capped at MaxDelay (or
+// MaxRetryAfter, if MaxDelay is 0) so that a server cannot stall the client
+// indefinitely.
+type PollPolicy struct {
+	InitialDelay time.Duration // delay between the first and the second poll
+	MaxDelay     time.Duration // upper bound for the computed delay between polls (0 means no bound)
+	Multiplier   float64       // backoff factor applied to the delay after each poll (values < 1 are treated as 1)
+	Jitter       float64       // fraction of the delay, in [0, 1], that is randomised
+	Deadline     time.Duration // overall time budget for polling (0 means no limit)
+	MaxAttempts  uint          // maximum number of polls (0 means no limit)
+}
+
+// DefaultPollPolicy is used when the user does not supply a PollPolicy.
+var DefaultPollPolicy = PollPolicy{
+	InitialDelay: PollPeriod,
+	MaxDelay:     10 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.1,
+	Deadline:     2 * time.Minute,
+}
+
+// Validate checks that the PollPolicy is well-formed and bounded.
+func (o PollPolicy) Validate() error {
+	if o.InitialDelay < 0 {
+		return errors.New("negative initial delay")
+	}
+
+	if o.MaxDelay < 0 {
+		return errors.New("negative max delay")
+	}
+
+	if o.Jitter < 0 || o.Jitter > 1 {
+		return fmt.Errorf("jitter must be in [0, 1], got %v", o.Jitter)
+	}
+
+	if o.Deadline < 0 {
+		return errors.New("negative deadline")
+	}
+
+	if o.Deadline == 0 && o.MaxAttempts == 0 {
+		return errors.New("at least one of deadline or max attempts must be set")
+	}
+
+	return nil
+}
+
+// Poller paces a poll loop according to a PollPolicy.
+type Poller struct {
+	policy   PollPolicy
+	attempts uint
+	delay    time.Duration
+	deadline time.Time
+}
+
+// NewPoller returns a Poller for the supplied PollPolicy. The policy's
+// Deadline, if any, starts counting from now.
+func NewPoller(p PollPolicy) *Poller {
+	o := Poller{
+		policy: p,
+		delay:  p.InitialDelay,
+	}
+
+	if p.Deadline > 0 {
+		o.deadline = time.Now().Add(p.Deadline)
+	}
+
+	return &o
+}
+
+// Wait blocks until the next poll is due. retryAfter is the delay requested
+// by the server in its last response (zero if none). ErrPollExhausted is
+// returned if the next poll would exceed the policy's budget, and the context
+// error is returned if ctx is done while waiting.
+func (o *Poller) Wait(ctx context.Context, retryAfter time.Duration) error {
+	if o.policy.MaxAttempts > 0 && o.attempts >= o.policy.MaxAttempts {
+		return ErrPollExhausted
+	}
+
+	var d time.Duration
+
+	switch {
+	case retryAfter > 0:
+		d = o.capRetryAfter(retryAfter)
+	case o.attempts > 0:
+		d = o.jittered(o.delay)
+		o.backoff()
+	}
+
+	if !o.deadline.IsZero() && time.Now().Add(d).After(o.deadline) {
+		return ErrPollExhausted
+	}
+
+	if d > 0 {
+		if err := Sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	o.attempts++
+
+	return nil
+}
+
+// Attempts returns the number of polls allowed so far.
+func (o *Poller) Attempts() uint {
+	return o.attempts
+}
+
+func (o *Poller) capRetryAfter(d time.Duration) time.Duration {
+	ceiling := o.policy.MaxDelay
+	if ceiling == 0 {
+		ceiling = MaxRetryAfter
+	}
+
+	if d > ceiling {
+		return ceiling
+	}
+
+	return d
+}
+
+func (o *Poller) backoff() {
+	m := o.policy.Multiplier
+	if m < 1 {
+		m = 1
+	}
+
+	o.delay = time.Duration(float64(o.delay) * m)
+
+	if o.policy.MaxDelay > 0 && o.delay > o.policy.MaxDelay {
+		o.delay = o.policy.MaxDelay
+	}
+}
+
+func (o *Poller) jittered(d time.Duration) time.Duration {
+	if o.policy.Jitter == 0 || d == 0 {
+		return d
+	}
+
+	jitterRandMu.Lock()
+	r := jitterRand.Float64()
+	jitterRandMu.Unlock()
+
+	// scale d by a random factor in [1-Jitter, 1+Jitter)
+	f := 1 + o.policy.Jitter*(2*r-1)
+
+	return time.Duration(float64(d) * f)
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollPolicy_Validate(t *testing.T) {
+	assert.NoError(t, DefaultPollPolicy.Validate())
+
+	p := PollPolicy{}
+	assert.EqualError(t, p.Validate(), "at least one of deadline or max attempts must be set")
+
+	p = PollPolicy{InitialDelay: -1, MaxAttempts: 1}
+	assert.EqualError(t, p.Validate(), "negative initial delay")
+
+	p = PollPolicy{MaxDelay: -1, MaxAttempts: 1}
+	assert.EqualError(t, p.Validate(), "negative max delay")
+
+	p = PollPolicy{Jitter: -0.5, MaxAttempts: 1}
+	assert.EqualError(t, p.Validate(), "jitter must be in [0, 1], got -0.5")
+
+	p = PollPolicy{Deadline: -1}
+	assert.EqualError(t, p.Validate(), "negative deadline")
+}
+
+func TestPoller_Wait_max_attempts(t *testing.T) {
+	ctx := context.Background()
+	p := NewPoller(PollPolicy{MaxAttempts: 3})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Wait(ctx, 0))
+	}
+
+	assert.ErrorIs(t, p.Wait(ctx, 0), ErrPollExhausted)
+	assert.Equal(t, uint(3), p.Attempts())
+}
+
+func TestPoller_Wait_backoff(t *testing.T) {
+	p := NewPoller(PollPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     25 * time.Millisecond,
+		Multiplier:   2,
+		MaxAttempts:  10,
+	})
+
+	expected := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		25 * time.Millisecond,
+		25 * time.Millisecond,
+	}
+
+	// the first poll is not delayed
+	require.NoError(t, p.Wait(context.Background(), 0))
+
+	for _, d := range expected {
+		assert.Equal(t, d, p.delay)
+		require.NoError(t, p.Wait(context.Background(), 0))
+	}
+}
+
+func TestPoller_Wait_deadline(t *testing.T) {
+	p := NewPoller(PollPolicy{
+		InitialDelay: time.Second,
+		Deadline:     100 * time.Millisecond,
+	})
+
+	require.NoError(t, p.Wait(context.Background(), 0))
+
+	start := time.Now()
+	assert.ErrorIs(t, p.Wait(context.Background(), 0), ErrPollExhausted)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestPoller_Wait_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := NewPoller(PollPolicy{MaxAttempts: 2})
+	assert.ErrorIs(t, p.Wait(ctx, time.Second), context.Canceled)
+}
+
+func TestPoller_Wait_retry_after_capped(t *testing.T) {
+	p := NewPoller(PollPolicy{MaxDelay: 20 * time.Millisecond, MaxAttempts: 2})
+	require.NoError(t, p.Wait(context.Background(), 0))
+
+	start := time.Now()
+	require.NoError(t, p.Wait(context.Background(), time.Hour))
+	assert.Less(t, time.Since(start), time.Second)
+
+	unbounded := NewPoller(PollPolicy{MaxAttempts: 2})
+	assert.Equal(t, MaxRetryAfter, unbounded.capRetryAfter(time.Hour))
+	assert.Equal(t, time.Second, unbounded.capRetryAfter(time.Second))
+}
+
+func TestPoller_jittered(t *testing.T) {
+	p := NewPoller(PollPolicy{Jitter: 0.5, MaxAttempts: 1})
+	d := time.Second
+
+	seen := map[time.Duration]bool{}
+
+	for i := 0; i < 100; i++ {
+		j := p.jittered(d)
+		assert.GreaterOrEqual(t, j, d/2)
+		assert.Less(t, j, d*3/2)
+		seen[j] = true
+	}
+
+	assert.Greater(t, len(seen), 1)
+
+	assert.Equal(t, d, NewPoller(PollPolicy{MaxAttempts: 1}).jittered(d))
+}
+
+func TestRetryAfter(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	assert.Equal(t, time.Duration(0), RetryAfter(res))
+
+	res.Header.Set("Retry-After", "120")
+	assert.Equal(t, 120*time.Second, RetryAfter(res))
+
+	res.Header.Set("Retry-After", "soon")
+	assert.Equal(t, time.Duration(0), RetryAfter(res))
+
+	res.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	d := RetryAfter(res)
+	assert.Greater(t, d, 59*time.Minute)
+	assert.LessOrEqual(t, d, time.Hour)
+
+	res.Header.Set("Retry-After", "Wed, 21 Oct 2015 07:28:00 GMT")
+	assert.Equal(t, time.Duration(0), RetryAfter(res))
+}
@@ -1,20 +1,65 @@
 package common
 
 import (
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 
 	"github.com/moogar0880/problems"
 )
 
+// Sentinel errors matched (via errors.Is) by a *ProblemError with the
+// corresponding HTTP status. ErrServerError matches any 5xx status.
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrServerError          = errors.New("server error")
+)
+
+var problemSentinels = map[int]error{
+	http.StatusBadRequest:           ErrBadRequest,
+	http.StatusUnauthorized:         ErrUnauthorized,
+	http.StatusForbidden:            ErrForbidden,
+	http.StatusNotFound:             ErrNotFound,
+	http.StatusConflict:             ErrConflict,
+	http.StatusUnsupportedMediaType: ErrUnsupportedMediaType,
+}
+
+// ProblemError is an RFC 7807 problem details object returned by a Veraison
+// service in response to a failed request. Responses with an unexpected
+// status and no problem details are reported as a ProblemError with type
+// "about:blank", the status code, and the corresponding title.
 type ProblemError struct {
 	problems.DefaultProblem
 }
 
 func (o *ProblemError) Error() string {
+	if o.Detail == "" {
+		return fmt.Sprintf("%d %s", o.ProblemStatus(), o.ProblemTitle())
+	}
 	return fmt.Sprintf("%d %s: %s", o.ProblemStatus(), o.ProblemTitle(), o.Detail)
 }
 
+// Is reports whether target is the sentinel error (e.g., ErrNotFound)
+// corresponding to the status of the problem.
+func (o *ProblemError) Is(target error) bool {
+	if target == ErrServerError {
+		return o.Status >= 500 && o.Status <= 599
+	}
+
+	sentinel, ok := problemSentinels[o.Status]
+
+	return ok && sentinel == target
+}
+
+// CheckResponse returns nil if the status of res is one of the expected ones,
+// and a *ProblemError otherwise. In the latter case, the problem details in
+// the response body, if any, are decoded.
 func CheckResponse(res *http.Response, expected ...int) error {
 	for _, exp := range expected {
 		if res.StatusCode == exp {
@@ -22,19 +67,29 @@ func CheckResponse(res *http.Response, expected ...int) error {
 		}
 	}
 
-	if res.Header.Get("Content-Type") == problems.ProblemMediaType {
-		var prob ProblemError
+	prob := ProblemError{DefaultProblem: *problems.NewStatusProblem(res.StatusCode)}
 
-		if err := DecodeJSONBody(res, &prob.DefaultProblem); err != nil {
-			return fmt.Errorf(
-				"could not decode problem response (status %d): %w",
-				res.StatusCode,
-				err,
-			)
-		}
+	if !isProblemResponse(res) {
+		res.Body.Close()
+		return &prob
+	}
 
+	if err := DecodeJSONBody(res, &prob.DefaultProblem); err != nil {
+		prob.Detail = fmt.Sprintf("could not decode problem response: %v", err)
 		return &prob
 	}
 
-	return fmt.Errorf("unexpected HTTP response code %d", res.StatusCode)
+	// the status of the response is authoritative
+	prob.Status = res.StatusCode
+
+	if prob.Title == "" {
+		prob.Title = http.StatusText(res.StatusCode)
+	}
+
+	return &prob
+}
+
+func isProblemResponse(res *http.Response) bool {
+	mt, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return err == nil && mt == problems.ProblemMediaType
 }
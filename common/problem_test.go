@@ -0,0 +1,84 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testResponse(status int, ct, body string) *http.Response {
+	res := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+
+	if ct != "" {
+		res.Header.Set("Content-Type", ct)
+	}
+
+	return res
+}
+
+func TestCheckResponse_expected(t *testing.T) {
+	res := testResponse(http.StatusCreated, "", "")
+	assert.NoError(t, CheckResponse(res, http.StatusOK, http.StatusCreated))
+}
+
+func TestCheckResponse_problem(t *testing.T) {
+	res := testResponse(
+		http.StatusConflict,
+		"application/problem+json; charset=utf-8",
+		`{
+			"type": "tag:veraison.example,2024:policy-exists",
+			"title": "Policy Exists",
+			"status": 409,
+			"detail": "policy already exists",
+			"instance": "/management/v1/policy/psa"
+		}`,
+	)
+
+	err := CheckResponse(res, http.StatusOK)
+	assert.EqualError(t, err, "409 Policy Exists: policy already exists")
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.NotErrorIs(t, err, ErrNotFound)
+
+	var prob *ProblemError
+	require.ErrorAs(t, err, &prob)
+	assert.Equal(t, "tag:veraison.example,2024:policy-exists", prob.Type)
+	assert.Equal(t, "/management/v1/policy/psa", prob.Instance)
+}
+
+func TestCheckResponse_no_problem_details(t *testing.T) {
+	err := CheckResponse(testResponse(http.StatusUnauthorized, "text/plain", "go away"))
+	assert.EqualError(t, err, "401 Unauthorized")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	var prob *ProblemError
+	require.ErrorAs(t, err, &prob)
+	assert.Equal(t, "about:blank", prob.Type)
+	assert.Equal(t, http.StatusUnauthorized, prob.Status)
+}
+
+func TestCheckResponse_server_error(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		err := CheckResponse(testResponse(status, "", ""))
+		assert.ErrorIs(t, err, ErrServerError)
+	}
+
+	err := CheckResponse(testResponse(http.StatusNotFound, "", ""))
+	assert.NotErrorIs(t, err, ErrServerError)
+}
+
+func TestCheckResponse_bad_problem(t *testing.T) {
+	err := CheckResponse(testResponse(http.StatusNotFound, "application/problem+json", "{"))
+	assert.ErrorContains(t, err, "404 Not Found: could not decode problem response")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header carrying the idempotency key of
+// a POST request. POSTs are only retried if they carry one.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy describes how requests that fail for transient reasons are
+// retried by Client. Only idempotent requests (GET, DELETE, and POSTs carrying
+// an idempotency key) are retried, and only on connection errors and on 429,
+// 502, 503 and 504 responses.
+//
+// The delay before the first retry is InitialDelay, and is multiplied by
+// Multiplier before each further retry, up to MaxDelay. A Retry-After header
+// in the failed response takes precedence over the computed delay, but is
+// capped at MaxDelay (or MaxRetryAfter, if MaxDelay is 0).
+type RetryPolicy struct {
+	MaxRetries   uint          // maximum number of retries per request
+	InitialDelay time.Duration // delay before the first retry
+	MaxDelay     time.Duration // upper bound for the computed delay between retries (0 means no bound)
+	Multiplier   float64       // backoff factor applied to the delay after each retry (values < 1 are treated as 1)
+	Jitter       float64       // fraction of the delay, in [0, 1], that is randomised
+	Budget       time.Duration // overall time budget for a request including its retries (0 means no limit)
+}
+
+// DefaultRetryPolicy is a reasonable RetryPolicy for riding out the restart
+// of a Veraison service.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:   4,
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.2,
+	Budget:       30 * time.Second,
+}
+
+// Validate checks that the RetryPolicy is well-formed.
+func (o RetryPolicy) Validate() error {
+	p := o.pollPolicy()
+
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if o.Budget < 0 {
+		return errors.New("negative budget")
+	}
+
+	return nil
+}
+
+// pollPolicy expresses the RetryPolicy as the PollPolicy pacing the attempts:
+// the first attempt is made straight away and each of the following ones is
+// a retry.
+func (o RetryPolicy) pollPolicy() PollPolicy {
+	return PollPolicy{
+		InitialDelay: o.InitialDelay,
+		MaxDelay:     o.MaxDelay,
+		Multiplier:   o.Multiplier,
+		Jitter:       o.Jitter,
+		Deadline:     o.Budget,
+		MaxAttempts:  o.MaxRetries + 1,
+	}
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx carrying the supplied idempotency
+// key. POST requests made by Client with the returned context send the key in
+// the Idempotency-Key header, which makes them eligible for retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return req.Header.Get(IdempotencyKeyHeader) != ""
+	default:
+		return false
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendWithRetry sends req according to the supplied RetryPolicy. The request
+// body is replayed on each attempt using req.GetBody. When retries are
+// exhausted, the last response (or error) is returned to the caller.
+func (c Client) sendWithRetry(req *http.Request, p RetryPolicy) (*http.Response, error) {
+	ctx := req.Context()
+	poller := NewPoller(p.pollPolicy())
+
+	var (
+		res        *http.Response
+		err        error
+		retryAfter time.Duration
+	)
+
+	for {
+		if werr := poller.Wait(ctx, retryAfter); werr != nil {
+			if errors.Is(werr, ErrPollExhausted) {
+				return res, err
+			}
+
+			if res != nil {
+				drainAndClose(res)
+			}
+
+			return nil, werr
+		}
+
+		if res != nil {
+			drainAndClose(res)
+		}
+
+		attempt := req
+		if poller.Attempts() > 1 {
+			if attempt, err = cloneRequest(req); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err = c.HTTPClient.Do(attempt)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			retryAfter = 0
+			continue
+		}
+
+		if !isRetryableStatus(res.StatusCode) {
+			return res, nil
+		}
+
+		retryAfter = RetryAfter(res)
+	}
+}
+
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return r, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("%s %q: request body cannot be replayed", req.Method, req.URL)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: replaying request body: %w", req.Method, req.URL, err)
+	}
+
+	r.Body = body
+
+	return r, nil
+}
+
+func drainAndClose(res *http.Response) {
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
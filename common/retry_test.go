@@ -0,0 +1,284 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxRetries:   3,
+	InitialDelay: 5 * time.Millisecond,
+	Multiplier:   2,
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	assert.NoError(t, DefaultRetryPolicy.Validate())
+	assert.NoError(t, RetryPolicy{}.Validate())
+
+	p := RetryPolicy{Budget: -1}
+	assert.EqualError(t, p.Validate(), "negative deadline")
+
+	p = RetryPolicy{Jitter: 1.5}
+	assert.EqualError(t, p.Validate(), "jitter must be in [0, 1], got 1.5")
+}
+
+func TestClient_SetRetryPolicy(t *testing.T) {
+	c := NewClient(nil)
+
+	err := c.SetRetryPolicy(RetryPolicy{InitialDelay: -1})
+	assert.EqualError(t, err, "invalid retry policy: negative initial delay")
+	assert.Nil(t, c.Retry)
+
+	require.NoError(t, c.SetRetryPolicy(testRetryPolicy))
+	assert.Equal(t, testRetryPolicy, *c.Retry)
+}
+
+func TestClient_GetResource_retry_transient(t *testing.T) {
+	statuses := []int{
+		http.StatusServiceUnavailable,
+		http.StatusBadGateway,
+		http.StatusOK,
+	}
+	calls := 0
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		w.WriteHeader(statuses[calls])
+		calls++
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	require.NoError(t, client.SetRetryPolicy(testRetryPolicy))
+
+	res, err := client.GetResource("application/json", "http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 3, calls)
+}
+
+func TestClient_GetResource_retry_exhausted(t *testing.T) {
+	calls := 0
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		calls++
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	require.NoError(t, client.SetRetryPolicy(testRetryPolicy))
+
+	res, err := client.GetResource("application/json", "http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+	assert.Equal(t, 4, calls)
+}
+
+func TestClient_GetResource_no_retry_without_policy(t *testing.T) {
+	calls := 0
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		calls++
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	res, err := client.GetResource("application/json", "http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestClient_GetResource_retry_after(t *testing.T) {
+	var calls []time.Time
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	require.NoError(t, client.SetRetryPolicy(testRetryPolicy))
+
+	res, err := client.GetResource("application/json", "http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	require.Len(t, calls, 2)
+	assert.GreaterOrEqual(t, calls[1].Sub(calls[0]), time.Second)
+}
+
+func TestClient_GetResource_retry_after_exceeds_budget(t *testing.T) {
+	calls := 0
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		calls++
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	p := testRetryPolicy
+	p.Budget = time.Second
+	require.NoError(t, client.SetRetryPolicy(p))
+
+	res, err := client.GetResource("application/json", "http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestClient_GetResource_retry_after_capped(t *testing.T) {
+	calls := 0
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	p := testRetryPolicy
+	p.MaxDelay = 10 * time.Millisecond
+	require.NoError(t, client.SetRetryPolicy(p))
+
+	start := time.Now()
+	res, err := client.GetResource("application/json", "http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 2, calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestClient_PostResource_retry_requires_idempotency_key(t *testing.T) {
+	var bodies []string
+	var keys []string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(b))
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+
+		if len(bodies)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	require.NoError(t, client.SetRetryPolicy(testRetryPolicy))
+
+	uri := "http://veraison.example/test"
+
+	// without an idempotency key, the POST is not retried
+	res, err := client.PostResource([]byte("payload"), "text/plain", "text/plain", uri)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, []string{"payload"}, bodies)
+
+	bodies = nil
+	keys = nil
+
+	// with an idempotency key, the POST is retried and the body replayed
+	ctx := WithIdempotencyKey(context.Background(), "abcd")
+	res, err = client.PostResourceContext(ctx, []byte("payload"), "text/plain", "text/plain", uri)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+	assert.Equal(t, []string{"abcd", "abcd"}, keys)
+}
+
+func TestClient_DeleteResource_retry_connection_error(t *testing.T) {
+	calls := 0
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// simulate a server going away mid-request
+			hj, ok := w.(http.Hijacker)
+			require.True(t, ok)
+			conn, _, err := hj.Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	require.NoError(t, client.SetRetryPolicy(testRetryPolicy))
+
+	err := client.DeleteResource("http://veraison.example/test")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestClient_GetResource_retry_cancelled(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	client, teardown := NewTestingHTTPClient(h)
+	defer teardown()
+
+	p := testRetryPolicy
+	p.InitialDelay = time.Second
+	require.NoError(t, client.SetRetryPolicy(p))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetResourceContext(ctx, "application/json", "http://veraison.example/test")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_GetResource_retry_no_server(t *testing.T) {
+	client := NewClient(nil)
+	client.HTTPClient.Transport = &http.Transport{
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Err: assert.AnError}
+		},
+	}
+
+	require.NoError(t, client.SetRetryPolicy(testRetryPolicy))
+
+	_, err := client.GetResource("application/json", "http://veraison.example/test")
+	assert.ErrorIs(t, err, assert.AnError)
+}
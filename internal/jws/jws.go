@@ -0,0 +1,165 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package jws implements the JWS signature algorithms (RFC 7518) shared by the
+// EAR verification and the policy signing code.
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Algorithms are the supported JWS algorithms
+var Algorithms = []string{"ES256", "ES384", "EdDSA", "PS256"}
+
+var pssOptions = &rsa.PSSOptions{
+	SaltLength: rsa.PSSSaltLengthEqualsHash,
+	Hash:       crypto.SHA256,
+}
+
+// IsSupported returns whether alg is one of Algorithms
+func IsSupported(alg string) bool {
+	for _, a := range Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// AlgorithmFor returns the algorithm used to sign with the private key
+// corresponding to pub
+func AlgorithmFor(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		}
+		return "", fmt.Errorf("unsupported EC curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	case *rsa.PublicKey:
+		return "PS256", nil
+	}
+
+	return "", fmt.Errorf("unsupported public key type %T", pub)
+}
+
+func digest(alg, signingInput string) []byte {
+	if alg == "ES384" {
+		d := sha512.Sum384([]byte(signingInput))
+		return d[:]
+	}
+
+	d := sha256.Sum256([]byte(signingInput))
+	return d[:]
+}
+
+// Sign signs signingInput with key using alg. key may be any crypto.Signer,
+// including ones backed by an HSM or a KMS, as long as its public key matches
+// alg.
+func Sign(key crypto.Signer, alg, signingInput string) ([]byte, error) {
+	switch alg {
+	case "ES256", "ES384":
+		size := 32
+		opts := crypto.Hash(crypto.SHA256)
+		if alg == "ES384" {
+			size, opts = 48, crypto.SHA384
+		}
+
+		der, err := key.Sign(rand.Reader, digest(alg, signingInput), opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return ecdsaConcat(der, size)
+	case "EdDSA":
+		return key.Sign(rand.Reader, []byte(signingInput), crypto.Hash(0))
+	case "PS256":
+		return key.Sign(rand.Reader, digest(alg, signingInput), pssOptions)
+	}
+
+	return nil, fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+// ecdsaConcat converts an ASN.1 DER ECDSA signature, as returned by
+// crypto.Signer, into the concatenation of R and S used by JWS (RFC 7518,
+// Section 3.4)
+func ecdsaConcat(der []byte, size int) ([]byte, error) {
+	var rs struct{ R, S *big.Int }
+
+	rest, err := asn1.Unmarshal(der, &rs)
+	if err != nil {
+		return nil, fmt.Errorf("decoding ECDSA signature: %w", err)
+	}
+
+	if len(rest) != 0 || rs.R.Sign() <= 0 || rs.S.Sign() <= 0 ||
+		rs.R.BitLen() > 8*size || rs.S.BitLen() > 8*size {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+
+	sig := make([]byte, 2*size)
+	rs.R.FillBytes(sig[:size])
+	rs.S.FillBytes(sig[size:])
+
+	return sig, nil
+}
+
+// Verify returns whether sig is a valid alg signature of signingInput by pub,
+// and whether pub can be used with alg in the first place
+func Verify(alg string, pub crypto.PublicKey, signingInput string, sig []byte) (ok, compatible bool) {
+	switch alg {
+	case "ES256":
+		return verifyECDSA(pub, elliptic.P256(), alg, signingInput, sig)
+	case "ES384":
+		return verifyECDSA(pub, elliptic.P384(), alg, signingInput, sig)
+	case "EdDSA":
+		k, isEd25519 := pub.(ed25519.PublicKey)
+		if !isEd25519 {
+			return false, false
+		}
+		return ed25519.Verify(k, []byte(signingInput), sig), true
+	case "PS256":
+		k, isRSA := pub.(*rsa.PublicKey)
+		if !isRSA {
+			return false, false
+		}
+		err := rsa.VerifyPSS(k, crypto.SHA256, digest(alg, signingInput), sig, pssOptions)
+		return err == nil, true
+	}
+
+	return false, false
+}
+
+func verifyECDSA(
+	pub crypto.PublicKey, crv elliptic.Curve, alg, signingInput string, sig []byte,
+) (ok, compatible bool) {
+	k, isECDSA := pub.(*ecdsa.PublicKey)
+	if !isECDSA || k.Curve != crv {
+		return false, false
+	}
+
+	size := (crv.Params().BitSize + 7) / 8
+	if len(sig) != 2*size {
+		return false, true
+	}
+
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+
+	return ecdsa.Verify(k, digest(alg, signingInput), r, s), true
+}
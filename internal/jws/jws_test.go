@@ -0,0 +1,68 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opaqueSigner hides the concrete type of the wrapped key, like an HSM or KMS
+// backed crypto.Signer would
+type opaqueSigner struct {
+	key crypto.Signer
+}
+
+func (o opaqueSigner) Public() crypto.PublicKey {
+	return o.key.Public()
+}
+
+func (o opaqueSigner) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return o.key.Sign(r, digest, opts)
+}
+
+func TestSign_generic_signer(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, key := range []crypto.Signer{p256, p384, ed, rsaKey} {
+		alg, err := AlgorithmFor(key.Public())
+		require.NoError(t, err)
+
+		for _, signer := range []crypto.Signer{key, opaqueSigner{key}} {
+			sig, err := Sign(signer, alg, "header.payload")
+			require.NoError(t, err, "%s %T", alg, signer)
+
+			ok, compatible := Verify(alg, key.Public(), "header.payload", sig)
+			assert.True(t, compatible, "%s %T", alg, signer)
+			assert.True(t, ok, "%s %T", alg, signer)
+
+			ok, _ = Verify(alg, key.Public(), "header.tampered", sig)
+			assert.False(t, ok, "%s %T", alg, signer)
+		}
+	}
+}
+
+func TestSign_unsupported_algorithm(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = Sign(key, "HS256", "header.payload")
+	assert.EqualError(t, err, `unsupported algorithm "HS256"`)
+}
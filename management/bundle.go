@@ -0,0 +1,385 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// PolicyBundleMediaType identifies the format of a PolicyBundle
+	PolicyBundleMediaType = "application/vnd.veraison.policy-bundle+json"
+
+	// PolicyHashAlg is the algorithm used for the content hashes of
+	// bundled policies
+	PolicyHashAlg = "sha-256"
+)
+
+// policyMediaTypes maps the policy types reported by the service to the media
+// type of their rules
+var policyMediaTypes = map[string]string{
+	"opa": OPARulesMediaType,
+}
+
+// policyTypeFor returns the policy type whose rules have media type ct
+func policyTypeFor(ct string) (string, error) {
+	for typ, mt := range policyMediaTypes {
+		if mt == ct {
+			return typ, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported policy media type %q", ct)
+}
+
+// PolicyBundle is a self-describing collection of policies exported from a
+// service instance, suitable for importing into another one.
+type PolicyBundle struct {
+	// MediaType is always PolicyBundleMediaType.
+	MediaType string `json:"media-type"`
+
+	// Created is the time the bundle was exported.
+	Created time.Time `json:"created"`
+
+	// Source is the management endpoint the policies were exported from.
+	Source string `json:"source,omitempty"`
+
+	// Policies are the exported policies, grouped by scheme and oldest
+	// first within each scheme.
+	Policies []*BundledPolicy `json:"policies"`
+}
+
+// BundledPolicy is a single policy within a PolicyBundle
+type BundledPolicy struct {
+	// Scheme is the attestation scheme the policy is associated with.
+	Scheme string `json:"scheme"`
+
+	// UUID identifies the policy on the source service instance.
+	UUID uuid.UUID `json:"uuid"`
+
+	// CTime is the creation time of the policy on the source service
+	// instance.
+	CTime time.Time `json:"ctime"`
+
+	// Name is the name of the policy.
+	Name string `json:"name"`
+
+	// Type identifies the policy engine used to evaluate the policy.
+	Type string `json:"type"`
+
+	// Rules are the rules of the policy.
+	Rules string `json:"rules"`
+
+	// Hash is the content hash of Rules, in the form "<alg>:<hex digest>".
+	Hash string `json:"hash"`
+
+	// Active indicates whether the policy was active on the source service
+	// instance.
+	Active bool `json:"active"`
+
+	// Signatures are detached JWS signatures over the policy (see
+	// SignPolicy).
+	Signatures []string `json:"signatures,omitempty"`
+}
+
+// PolicyHash returns the content hash of the supplied rules, in the form used
+// by BundledPolicy.Hash.
+func PolicyHash(rules []byte) string {
+	sum := sha256.Sum256(rules)
+	return PolicyHashAlg + ":" + hex.EncodeToString(sum[:])
+}
+
+// Verify checks that the content hash of the policy matches its rules.
+func (o BundledPolicy) Verify() error {
+	alg, _, found := strings.Cut(o.Hash, ":")
+	if !found {
+		return fmt.Errorf("malformed content hash %q", o.Hash)
+	}
+
+	if alg != PolicyHashAlg {
+		return fmt.Errorf("unsupported content hash algorithm %q", alg)
+	}
+
+	if o.Hash != PolicyHash([]byte(o.Rules)) {
+		return errors.New("content hash mismatch")
+	}
+
+	return nil
+}
+
+func (o BundledPolicy) String() string {
+	return fmt.Sprintf("%s/%s (%s)", o.Scheme, o.Name, o.UUID)
+}
+
+// DecodePolicyBundle decodes a JSON encoded PolicyBundle, checking that it is
+// in a supported format.
+func DecodePolicyBundle(data []byte) (*PolicyBundle, error) {
+	var bundle PolicyBundle
+
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("decoding policy bundle: %w", err)
+	}
+
+	if bundle.MediaType != PolicyBundleMediaType {
+		return nil, fmt.Errorf("unsupported policy bundle type %q", bundle.MediaType)
+	}
+
+	return &bundle, nil
+}
+
+// ExportPolicies returns a bundle with all the policies associated with the
+// specified schemes.
+func (o *Service) ExportPolicies(schemes ...string) (*PolicyBundle, error) {
+	return o.ExportPoliciesContext(context.Background(), schemes...)
+}
+
+// ExportPoliciesContext is like ExportPolicies but binds the requests to the
+// supplied context.
+func (o *Service) ExportPoliciesContext(
+	ctx context.Context,
+	schemes ...string,
+) (*PolicyBundle, error) {
+	if len(schemes) == 0 {
+		return nil, errors.New("no schemes specified")
+	}
+
+	bundle := PolicyBundle{
+		MediaType: PolicyBundleMediaType,
+		Created:   time.Now().UTC(),
+		Policies:  []*BundledPolicy{},
+	}
+
+	if o.EndPointURI != nil {
+		bundle.Source = o.EndPointURI.String()
+	}
+
+	for _, scheme := range schemes {
+		policies, err := o.GetPolicyHistoryContext(ctx, scheme, "")
+		if err != nil {
+			return nil, fmt.Errorf("retrieving policies for scheme %q: %w", scheme, err)
+		}
+
+		for _, p := range policies {
+			bundle.Policies = append(bundle.Policies, &BundledPolicy{
+				Scheme: scheme,
+				UUID:   p.UUID,
+				CTime:  p.CTime,
+				Name:   p.Name,
+				Type:   p.Type,
+				Rules:  p.Rules,
+				Hash:   PolicyHash([]byte(p.Rules)),
+				Active: p.Active,
+			})
+		}
+	}
+
+	return &bundle, nil
+}
+
+// ImportOutcome describes what ImportPolicies did with a bundled policy
+type ImportOutcome string
+
+const (
+	// ImportCreated means that the policy was created on the target
+	// service instance
+	ImportCreated ImportOutcome = "created"
+
+	// ImportExisting means that a policy with the same scheme, name and
+	// rules already existed on the target service instance, and has been
+	// used instead of creating a duplicate
+	ImportExisting ImportOutcome = "existing"
+
+	// ImportFailed means that the policy could not be imported
+	ImportFailed ImportOutcome = "failed"
+)
+
+// ImportResult is the outcome of importing one bundled policy
+type ImportResult struct {
+	// Source is the bundled policy.
+	Source *BundledPolicy
+
+	// Outcome is what was done with the bundled policy.
+	Outcome ImportOutcome
+
+	// Policy is the corresponding policy on the target service instance.
+	// It is nil if Outcome is ImportFailed.
+	Policy *Policy
+
+	// Activated indicates whether Policy has been activated.
+	Activated bool
+
+	// Err is the reason the import, or the activation, of the policy
+	// failed.
+	Err error
+}
+
+func (o ImportResult) String() string {
+	s := fmt.Sprintf("%s: %s", o.Source, o.Outcome)
+
+	if o.Policy != nil {
+		s += fmt.Sprintf(" as %s", o.Policy.UUID)
+	}
+
+	if o.Activated {
+		s += ", activated"
+	}
+
+	if o.Err != nil {
+		s += fmt.Sprintf(": %v", o.Err)
+	}
+
+	return s
+}
+
+// ImportPolicies recreates the policies in bundle on the service. The content
+// hash of each policy is verified before it is created, and a policy is not
+// duplicated if one with the same scheme, name and rules already exists. If
+// activate is true, the policies that were active on the source service
+// instance are activated once all the policies have been imported.
+//
+// A failure to import a policy does not stop the import of the others: the
+// outcome for each bundled policy is reported in the returned results, in
+// bundle order. An error is only returned if the bundle cannot be processed
+// at all, or if the policies of a scheme cannot be retrieved from the
+// service. In the latter case the import stops there and no policy is
+// activated: the returned results report the policies imported so far, and
+// mark the remaining ones as ImportFailed.
+//
+// The signatures of the bundled policies are passed on to
+// CreateSignedPolicy and ActivateSignedPolicy, so that they are enforced if
+// the service has a PolicyVerifier.
+func (o *Service) ImportPolicies(bundle *PolicyBundle, activate bool) ([]*ImportResult, error) {
+	return o.ImportPoliciesContext(context.Background(), bundle, activate)
+}
+
+// ImportPoliciesContext is like ImportPolicies but binds the requests to the
+// supplied context.
+func (o *Service) ImportPoliciesContext(
+	ctx context.Context,
+	bundle *PolicyBundle,
+	activate bool,
+) ([]*ImportResult, error) {
+	if bundle == nil {
+		return nil, errors.New("no bundle supplied")
+	}
+
+	if bundle.MediaType != PolicyBundleMediaType {
+		return nil, fmt.Errorf("unsupported policy bundle type %q", bundle.MediaType)
+	}
+
+	for _, bp := range bundle.Policies {
+		if bp == nil {
+			return nil, errors.New("empty policy in bundle")
+		}
+	}
+
+	existing := map[string][]*Policy{}
+	results := make([]*ImportResult, len(bundle.Policies))
+
+	for i, bp := range bundle.Policies {
+		res := &ImportResult{Source: bp}
+		results[i] = res
+
+		if _, ok := existing[bp.Scheme]; !ok {
+			policies, err := o.GetPoliciesContext(ctx, bp.Scheme, "")
+			if err != nil {
+				err = fmt.Errorf(
+					"retrieving policies for scheme %q: %w", bp.Scheme, err,
+				)
+				failImports(results[i:], bundle.Policies[i:], err)
+				return results, err
+			}
+			existing[bp.Scheme] = policies
+		}
+
+		o.importPolicy(ctx, bp, existing[bp.Scheme], res)
+
+		if res.Policy != nil && res.Outcome == ImportCreated {
+			existing[bp.Scheme] = append(existing[bp.Scheme], res.Policy)
+		}
+	}
+
+	if !activate {
+		return results, nil
+	}
+
+	for _, res := range results {
+		if !res.Source.Active || res.Policy == nil {
+			continue
+		}
+
+		err := o.ActivateSignedPolicyContext(
+			ctx, res.Source.Scheme, res.Policy.UUID, res.Source.Signatures,
+		)
+		if err != nil {
+			res.Err = fmt.Errorf("activating policy: %w", err)
+			continue
+		}
+
+		res.Policy.Active = true
+		res.Activated = true
+	}
+
+	return results, nil
+}
+
+// failImports marks the imports of the supplied bundled policies as failed
+// with err
+func failImports(results []*ImportResult, policies []*BundledPolicy, err error) {
+	for i, bp := range policies {
+		if results[i] == nil {
+			results[i] = &ImportResult{Source: bp}
+		}
+		results[i].Outcome = ImportFailed
+		results[i].Err = err
+	}
+}
+
+func (o *Service) importPolicy(
+	ctx context.Context,
+	bp *BundledPolicy,
+	existing []*Policy,
+	res *ImportResult,
+) {
+	res.Outcome = ImportFailed
+
+	if err := bp.Verify(); err != nil {
+		res.Err = err
+		return
+	}
+
+	for _, p := range existing {
+		if p.Name == bp.Name && p.Type == bp.Type && p.Rules == bp.Rules {
+			res.Outcome = ImportExisting
+			res.Policy = p
+			return
+		}
+	}
+
+	ct, ok := policyMediaTypes[bp.Type]
+	if !ok {
+		res.Err = fmt.Errorf("unsupported policy type %q", bp.Type)
+		return
+	}
+
+	p, err := o.CreateSignedPolicyContext(
+		ctx, bp.Scheme, ct, []byte(bp.Rules), bp.Name, bp.Signatures,
+	)
+	if err != nil {
+		res.Err = fmt.Errorf("creating policy: %w", err)
+		return
+	}
+
+	res.Outcome = ImportCreated
+	res.Policy = p
+}
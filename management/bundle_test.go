@@ -0,0 +1,162 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/common"
+)
+
+func TestBundledPolicy_Verify(t *testing.T) {
+	bp := BundledPolicy{Rules: "package policy\n", Hash: PolicyHash([]byte("package policy\n"))}
+	assert.NoError(t, bp.Verify())
+
+	bp.Rules = "package policy\n\nexecutables = 96\n"
+	assert.EqualError(t, bp.Verify(), "content hash mismatch")
+
+	bp.Hash = "md5:d41d8cd98f00b204e9800998ecf8427e"
+	assert.EqualError(t, bp.Verify(), `unsupported content hash algorithm "md5"`)
+
+	bp.Hash = "deadbeef"
+	assert.EqualError(t, bp.Verify(), `malformed content hash "deadbeef"`)
+}
+
+func TestDecodePolicyBundle_bad_type(t *testing.T) {
+	_, err := DecodePolicyBundle([]byte(`{"media-type": "application/json", "policies": []}`))
+	assert.EqualError(t, err, `unsupported policy bundle type "application/json"`)
+}
+
+func TestService_ExportPolicies_no_schemes(t *testing.T) {
+	service := &Service{EndPointURI: testEndpointURI}
+
+	_, err := service.ExportPolicies()
+	assert.EqualError(t, err, "no schemes specified")
+}
+
+func TestService_ExportImportPolicies(t *testing.T) {
+	staging := newTestPolicyStore(t)
+	staging.add("psa", "default", "psa v1\n", false)
+	psaActive := staging.add("psa", "default", "psa v2\n", true)
+	staging.add("cca", "default", "cca rules\n", true)
+	staging.add("tpm", "default", "tpm rules\n", true)
+
+	stagingService, teardown := staging.service()
+	defer teardown()
+
+	bundle, err := stagingService.ExportPolicies("psa", "cca")
+	require.NoError(t, err)
+	require.Len(t, bundle.Policies, 3)
+	assert.Equal(t, PolicyBundleMediaType, bundle.MediaType)
+	assert.Equal(t, psaActive.UUID, bundle.Policies[1].UUID)
+	assert.True(t, bundle.Policies[1].Active)
+	assert.Equal(t, PolicyHash([]byte("psa v2\n")), bundle.Policies[1].Hash)
+
+	data, err := json.Marshal(bundle)
+	require.NoError(t, err)
+
+	bundle, err = DecodePolicyBundle(data)
+	require.NoError(t, err)
+
+	// tamper with the cca policy
+	bundle.Policies[2].Rules = "evil rules\n"
+
+	production := newTestPolicyStore(t)
+	existing := production.add("psa", "default", "psa v1\n", true)
+
+	productionService, teardown := production.service()
+	defer teardown()
+
+	results, err := productionService.ImportPolicies(bundle, true)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, ImportExisting, results[0].Outcome)
+	assert.Equal(t, existing.UUID, results[0].Policy.UUID)
+	assert.False(t, results[0].Activated)
+
+	assert.Equal(t, ImportCreated, results[1].Outcome)
+	assert.True(t, results[1].Activated)
+	assert.NoError(t, results[1].Err)
+
+	assert.Equal(t, ImportFailed, results[2].Outcome)
+	assert.Nil(t, results[2].Policy)
+	assert.EqualError(t, results[2].Err, "content hash mismatch")
+
+	require.Len(t, production.policies["psa"], 2)
+	assert.False(t, production.policies["psa"][0].Active)
+	assert.True(t, production.policies["psa"][1].Active)
+	assert.Equal(t, "psa v2\n", production.policies["psa"][1].Rules)
+	assert.Empty(t, production.policies["cca"])
+
+	assert.Equal(t, []string{
+		"POST policy/psa",
+		"POST policy/psa/" + results[1].Policy.UUID.String() + "/activate",
+	}, production.requests)
+}
+
+func TestService_ImportPolicies_nil_entry(t *testing.T) {
+	production := newTestPolicyStore(t)
+
+	productionService, teardown := production.service()
+	defer teardown()
+
+	bundle := &PolicyBundle{
+		MediaType: PolicyBundleMediaType,
+		Policies: []*BundledPolicy{
+			{Scheme: "psa", Name: "default", Type: "opa", Rules: "psa\n", Hash: PolicyHash([]byte("psa\n"))},
+			nil,
+		},
+	}
+
+	results, err := productionService.ImportPolicies(bundle, true)
+	assert.EqualError(t, err, "empty policy in bundle")
+	assert.Nil(t, results)
+	assert.Empty(t, production.requests)
+}
+
+func TestService_ImportPolicies_list_failure(t *testing.T) {
+	production := newTestPolicyStore(t)
+
+	client, teardown := common.NewTestingHTTPClient(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/policies/cca") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			production.ServeHTTP(w, r)
+		},
+	))
+	defer teardown()
+
+	productionService := &Service{EndPointURI: testEndpointURI, Client: client}
+
+	bundle := &PolicyBundle{
+		MediaType: PolicyBundleMediaType,
+		Policies: []*BundledPolicy{
+			{Scheme: "psa", Name: "default", Type: "opa", Rules: "psa\n", Hash: PolicyHash([]byte("psa\n")), Active: true},
+			{Scheme: "cca", Name: "default", Type: "opa", Rules: "cca\n", Hash: PolicyHash([]byte("cca\n"))},
+			{Scheme: "tpm", Name: "default", Type: "opa", Rules: "tpm\n", Hash: PolicyHash([]byte("tpm\n"))},
+		},
+	}
+
+	results, err := productionService.ImportPolicies(bundle, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `retrieving policies for scheme "cca"`)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, ImportCreated, results[0].Outcome)
+	require.NotNil(t, results[0].Policy)
+	assert.False(t, results[0].Activated)
+
+	for _, res := range results[1:] {
+		assert.Equal(t, ImportFailed, res.Outcome)
+		assert.Nil(t, res.Policy)
+		assert.Equal(t, err, res.Err)
+	}
+
+	assert.Equal(t, []string{"POST policy/psa"}, production.requests)
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/veraison/apiclient/common"
+)
+
+// Names of the management API endpoints, as advertised in the discovery
+// document
+const (
+	CreatePolicyEndpoint       = "createPolicy"
+	ActivatePolicyEndpoint     = "activatePolicy"
+	DeactivatePoliciesEndpoint = "deactivatePolicies"
+	GetActivePolicyEndpoint    = "getActivePolicy"
+	GetPolicyEndpoint          = "getPolicy"
+	GetPoliciesEndpoint        = "getPolicies"
+	DeletePolicyEndpoint       = "deletePolicy"
+	DeletePoliciesEndpoint     = "deletePolicies"
+)
+
+// ServiceStateReady is the service state advertised by a service that is
+// ready to accept requests
+const ServiceStateReady = common.ServiceStateReady
+
+// defaultEndpoints are the paths, relative to Service.EndPointURI, used for
+// endpoints that have not been discovered. ":scheme" and ":uuid" are replaced
+// with the scheme name and the policy UUID, respectively.
+var defaultEndpoints = map[string]string{
+	CreatePolicyEndpoint:       "policy/:scheme",
+	ActivatePolicyEndpoint:     "policy/:scheme/:uuid/activate",
+	DeactivatePoliciesEndpoint: "policies/:scheme/deactivate",
+	GetActivePolicyEndpoint:    "policy/:scheme",
+	GetPolicyEndpoint:          "policy/:scheme/:uuid",
+	GetPoliciesEndpoint:        "policies/:scheme",
+	DeletePolicyEndpoint:       "policy/:scheme/:uuid",
+	DeletePoliciesEndpoint:     "policies/:scheme",
+}
+
+// Discovery models the well-known discovery document of the management
+// service. The embedded ServiceInfo lists the policy media types accepted by
+// the service, and maps the endpoint names (e.g., CreatePolicyEndpoint) to
+// their path templates, e.g., "/management/v1/policy/:scheme".
+type Discovery struct {
+	common.ServiceInfo
+
+	// AttestationSchemes are the names of the attestation schemes
+	// supported by the service.
+	AttestationSchemes []string `json:"attestation-schemes"`
+}
+
+// GetServiceInfo returns the discovery document of the service.
+func (o *Service) GetServiceInfo() (*Discovery, error) {
+	return o.GetServiceInfoContext(context.Background())
+}
+
+// GetServiceInfoContext is like GetServiceInfo but binds the request to the
+// supplied context.
+func (o *Service) GetServiceInfoContext(ctx context.Context) (*Discovery, error) {
+	wellKnownURI := &url.URL{
+		Scheme: o.EndPointURI.Scheme,
+		Host:   o.EndPointURI.Host,
+		Path:   WellKnownPath,
+	}
+
+	res, err := o.Client.GetResourceContext(ctx, WellKnownMediaType, wellKnownURI.String())
+	if err != nil {
+		return nil, fmt.Errorf("get request failed: %w", err)
+	}
+
+	if err := common.CheckResponse(res, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var info Discovery
+
+	if err := common.DecodeJSONBody(res, &info); err != nil {
+		return nil, fmt.Errorf(
+			"could not decode well-known info response (status %d): %w",
+			res.StatusCode,
+			err,
+		)
+	}
+
+	return &info, nil
+}
+
+// Discover fetches the discovery document of the service and configures the
+// Service to use the advertised endpoint paths from then on. This allows
+// talking to deployments that mount the API under a non-default prefix.
+func (o *Service) Discover() (*Discovery, error) {
+	return o.DiscoverContext(context.Background())
+}
+
+// DiscoverContext is like Discover but binds the request to the supplied
+// context.
+func (o *Service) DiscoverContext(ctx context.Context) (*Discovery, error) {
+	info, err := o.GetServiceInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Endpoints = info.APIEndpoints
+
+	return info, nil
+}
+
+// endpointURI returns the URI of the named endpoint for the supplied scheme
+// and (if the endpoint requires one) policy UUID. Endpoints advertised by the
+// service take precedence over the default ones. Absolute path templates are
+// resolved against the host of EndPointURI, relative ones against
+// EndPointURI itself. The scheme and UUID are path-escaped, so that each
+// always fills exactly one path segment.
+func (o *Service) endpointURI(name, scheme string, policyID ...string) (*url.URL, error) {
+	tmpl, ok := o.Endpoints[name]
+	if !ok || tmpl == "" {
+		tmpl = defaultEndpoints[name]
+	}
+
+	if tmpl == "" {
+		return nil, fmt.Errorf("no path for endpoint %q", name)
+	}
+
+	replacements := []string{":scheme", scheme}
+	if len(policyID) > 0 {
+		replacements = append(replacements, ":uuid", policyID[0])
+	}
+
+	for i := 1; i < len(replacements); i += 2 {
+		v := replacements[i]
+		if v == "." || v == ".." {
+			return nil, fmt.Errorf("invalid %s %q", replacements[i-1][1:], v)
+		}
+		replacements[i] = url.PathEscape(v)
+	}
+
+	path := strings.NewReplacer(replacements...).Replace(tmpl)
+
+	// JoinPath takes path to be escaped already
+	if strings.HasPrefix(path, "/") {
+		base := url.URL{Scheme: o.EndPointURI.Scheme, Host: o.EndPointURI.Host}
+		return base.JoinPath(path), nil
+	}
+
+	return o.EndPointURI.JoinPath(path), nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// SortPoliciesByCTime sorts the supplied policies by creation time, oldest
+// first. Policies created at the same time keep their relative order.
+func SortPoliciesByCTime(policies []*Policy) {
+	sort.SliceStable(policies, func(i, j int) bool {
+		return policies[i].CTime.Before(policies[j].CTime)
+	})
+}
+
+// DiffPolicies returns a unified diff between the rules of two policy
+// versions. Either can be nil, in which case its rules are taken to be empty.
+func DiffPolicies(from, to *Policy) (string, error) {
+	return diffRules(policyRules(from), policyRules(to), policyLabel(from), policyLabel(to))
+}
+
+func policyRules(p *Policy) string {
+	if p == nil {
+		return ""
+	}
+	return p.Rules
+}
+
+func policyLabel(p *Policy) string {
+	if p == nil {
+		return "/dev/null"
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, p.UUID)
+}
+
+func diffRules(from, to, fromLabel, toLabel string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromLabel,
+		ToFile:   toLabel,
+		Context:  3,
+	})
+}
+
+// splitLines splits s into newline-terminated lines, as expected by difflib
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+
+	return lines
+}
+
+// GetPolicyHistory returns all the versions of the named policy associated
+// with the specified scheme, oldest first. If name is empty, the versions of
+// all the policies associated with the scheme are returned.
+func (o *Service) GetPolicyHistory(scheme, name string) ([]*Policy, error) {
+	return o.GetPolicyHistoryContext(context.Background(), scheme, name)
+}
+
+// GetPolicyHistoryContext is like GetPolicyHistory but binds the request to
+// the supplied context.
+func (o *Service) GetPolicyHistoryContext(
+	ctx context.Context,
+	scheme string,
+	name string,
+) ([]*Policy, error) {
+	policies, err := o.GetPoliciesContext(ctx, scheme, name)
+	if err != nil {
+		return nil, err
+	}
+
+	SortPoliciesByCTime(policies)
+
+	return policies, nil
+}
+
+// RollbackPolicy rolls the named policy back to its previous version, i.e.
+// it activates the version of the named policy that was created immediately
+// before (by CTime) the currently active one, and returns it. If name is
+// empty, the name of the currently active policy is used.
+//
+// This is not an undo of the last activation: the service does not record
+// activations, so a policy that was active before a different policy (i.e.,
+// one with another name) got activated cannot be restored this way, and
+// rolling back twice steps two versions back rather than returning to where
+// it started. To return to a specific version, activate it explicitly with
+// ActivatePolicy, e.g. after looking it up with GetPolicyHistory.
+func (o *Service) RollbackPolicy(scheme, name string) (*Policy, error) {
+	return o.RollbackPolicyContext(context.Background(), scheme, name)
+}
+
+// RollbackPolicyContext is like RollbackPolicy but binds the requests to the
+// supplied context.
+func (o *Service) RollbackPolicyContext(
+	ctx context.Context,
+	scheme string,
+	name string,
+) (*Policy, error) {
+	return o.RollbackSignedPolicyContext(ctx, scheme, name, nil)
+}
+
+// RollbackSignedPolicy is like RollbackPolicy, but also supplies the detached
+// signatures of the version being activated (see SignPolicy), which are
+// checked against the PolicyVerifier of the Service, if any.
+func (o *Service) RollbackSignedPolicy(scheme, name string, signatures []string) (*Policy, error) {
+	return o.RollbackSignedPolicyContext(context.Background(), scheme, name, signatures)
+}
+
+// RollbackSignedPolicyContext is like RollbackSignedPolicy but binds the
+// requests to the supplied context.
+func (o *Service) RollbackSignedPolicyContext(
+	ctx context.Context,
+	scheme string,
+	name string,
+	signatures []string,
+) (*Policy, error) {
+	history, err := o.GetPolicyHistoryContext(ctx, scheme, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*Policy
+
+	active := -1
+
+	for _, p := range history {
+		if p.Active && name == "" {
+			name = p.Name
+		}
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("no active policy for scheme %q", scheme)
+	}
+
+	for _, p := range history {
+		if p.Name != name {
+			continue
+		}
+
+		if p.Active {
+			active = len(versions)
+		}
+
+		versions = append(versions, p)
+	}
+
+	switch {
+	case len(versions) == 0:
+		return nil, fmt.Errorf("no policy named %q for scheme %q", name, scheme)
+	case active == -1:
+		return nil, fmt.Errorf("policy %q is not active for scheme %q", name, scheme)
+	case active == 0:
+		return nil, errors.New("the active policy version has no previous version")
+	}
+
+	previous := versions[active-1]
+
+	if err := o.ActivateSignedPolicyContext(ctx, scheme, previous.UUID, signatures); err != nil {
+		return nil, fmt.Errorf("activating policy %s: %w", previous.UUID, err)
+	}
+
+	versions[active].Active = false
+	previous.Active = true
+
+	return previous, nil
+}
@@ -0,0 +1,121 @@
+package management
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortPoliciesByCTime(t *testing.T) {
+	now := time.Now()
+	a := &Policy{Name: "a", CTime: now}
+	b := &Policy{Name: "b", CTime: now.Add(-time.Hour)}
+	c := &Policy{Name: "c", CTime: now.Add(time.Hour)}
+
+	policies := []*Policy{a, b, c}
+	SortPoliciesByCTime(policies)
+
+	assert.Equal(t, []*Policy{b, a, c}, policies)
+}
+
+func TestDiffPolicies(t *testing.T) {
+	from := &Policy{UUID: uuid.New(), Name: "test", Rules: "a\nb\nc\n"}
+	to := &Policy{UUID: uuid.New(), Name: "test", Rules: "a\nB\nc\n"}
+
+	diff, err := DiffPolicies(from, to)
+	require.NoError(t, err)
+
+	expected := "--- test (" + from.UUID.String() + ")\n" +
+		"+++ test (" + to.UUID.String() + ")\n" +
+		"@@ -1,3 +1,3 @@\n" +
+		" a\n-b\n+B\n c\n"
+	assert.Equal(t, expected, diff)
+
+	diff, err = DiffPolicies(nil, to)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "--- /dev/null\n")
+
+	diff, err = DiffPolicies(from, from)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+}
+
+func TestService_GetPolicyHistory(t *testing.T) {
+	store := newTestPolicyStore(t)
+	first := store.add("psa", "default", "v1", false)
+	second := store.add("psa", "default", "v2", true)
+
+	// store the newest first to check that the history gets sorted
+	store.policies["psa"] = []*Policy{second, first}
+
+	service, teardown := store.service()
+	defer teardown()
+
+	history, err := service.GetPolicyHistory("psa", "")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, first.UUID, history[0].UUID)
+	assert.Equal(t, second.UUID, history[1].UUID)
+}
+
+func TestService_RollbackPolicy(t *testing.T) {
+	store := newTestPolicyStore(t)
+	first := store.add("psa", "default", "v1", false)
+	store.add("psa", "other", "other", false)
+	second := store.add("psa", "default", "v2", false)
+	third := store.add("psa", "default", "v3", true)
+
+	service, teardown := store.service()
+	defer teardown()
+
+	pol, err := service.RollbackPolicy("psa", "default")
+	require.NoError(t, err)
+	assert.Equal(t, second.UUID, pol.UUID)
+	assert.True(t, pol.Active)
+	assert.True(t, second.Active)
+	assert.False(t, third.Active)
+
+	// an empty name means the currently active policy
+	pol, err = service.RollbackPolicy("psa", "")
+	require.NoError(t, err)
+	assert.Equal(t, first.UUID, pol.UUID)
+	assert.True(t, first.Active)
+
+	_, err = service.RollbackPolicy("psa", "default")
+	assert.EqualError(t, err, "the active policy version has no previous version")
+
+	_, err = service.RollbackPolicy("psa", "other")
+	assert.EqualError(t, err, `policy "other" is not active for scheme "psa"`)
+
+	_, err = service.RollbackPolicy("psa", "missing")
+	assert.EqualError(t, err, `no policy named "missing" for scheme "psa"`)
+
+	_, err = service.RollbackPolicy("cca", "")
+	assert.EqualError(t, err, `no active policy for scheme "cca"`)
+
+	assert.Equal(t, []string{
+		"POST policy/psa/" + second.UUID.String() + "/activate",
+		"POST policy/psa/" + first.UUID.String() + "/activate",
+	}, store.requests)
+}
+
+func TestService_RollbackPolicy_not_an_undo(t *testing.T) {
+	store := newTestPolicyStore(t)
+	store.add("psa", "default", "v1", false)
+	other := store.add("psa", "other", "other", false)
+	second := store.add("psa", "default", "v2", true)
+
+	service, teardown := store.service()
+	defer teardown()
+
+	// even if "other" was the active policy before v2 of "default" got
+	// activated, the previous version of "default" is what gets activated
+	pol, err := service.RollbackPolicy("psa", "")
+	require.NoError(t, err)
+	assert.Equal(t, "default", pol.Name)
+	assert.NotEqual(t, second.UUID, pol.UUID)
+	assert.False(t, other.Active)
+}
@@ -4,10 +4,12 @@
 package management
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/veraison/apiclient/auth"
@@ -31,6 +33,22 @@ type Service struct {
 	// EndPointURI is the top-level service API URL. Individual operations
 	// endpoints are relative to this.
 	EndPointURI *url.URL
+
+	// Endpoints, if set, maps endpoint names (e.g., CreatePolicyEndpoint)
+	// to the path templates advertised by the service (see Discover).
+	// Endpoints missing from the map use the default paths relative to
+	// EndPointURI.
+	Endpoints map[string]string
+
+	// PolicyVerifier, if set, enables client-side enforcement of policy
+	// signatures: policies are only created or activated if their
+	// signatures, as supplied to CreateSignedPolicy or
+	// ActivateSignedPolicy, satisfy the verifier.
+	PolicyVerifier *PolicyVerifier
+
+	// WatchInterval is the delay between the polls made by
+	// WatchActivePolicy. DefaultWatchInterval is used if it is 0.
+	WatchInterval time.Duration
 }
 
 // NewService creates a new Service instance using the provided endpoint
@@ -65,7 +83,16 @@ func NewInsecureTLSService(uri string, a auth.IAuthenticator) (*Service, error)
 // system certs). If the supplied IAuthenticator is not nil, that will be used
 // to set the Authorization header in the service requests.
 func NewTLSService(uri string, a auth.IAuthenticator, certPaths []string) (*Service, error) {
-	cli, err := common.NewTLSClient(a, certPaths)
+	return NewTLSServiceWithOptions(uri, a, auth.TLSOptions{CACerts: certPaths})
+}
+
+// NewTLSServiceWithOptions creates a new Service instance using the provided
+// endpoint URI and an HTTPS client configured according to the supplied TLS
+// options (e.g., to present a client certificate). If the supplied
+// IAuthenticator is not nil, that will be used to set the Authorization header
+// in the service requests.
+func NewTLSServiceWithOptions(uri string, a auth.IAuthenticator, opts auth.TLSOptions) (*Service, error) {
+	cli, err := common.NewTLSClientWithOptions(a, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +123,18 @@ func (o *Service) SetEndpointURI(uri string) error {
 // CreateOPAPolicy is a wrapper around CreatePolicy that assumes the OPA media
 // type.
 func (o *Service) CreateOPAPolicy(scheme string, rules []byte, name string) (*Policy, error) {
-	return o.CreatePolicy(scheme, OPARulesMediaType, rules, name)
+	return o.CreateOPAPolicyContext(context.Background(), scheme, rules, name)
+}
+
+// CreateOPAPolicyContext is like CreateOPAPolicy but binds the request to the
+// supplied context.
+func (o *Service) CreateOPAPolicyContext(
+	ctx context.Context,
+	scheme string,
+	rules []byte,
+	name string,
+) (*Policy, error) {
+	return o.CreatePolicyContext(ctx, scheme, OPARulesMediaType, rules, name)
 }
 
 // CreatePolicy creates a new policy associated with the specified scheme based
@@ -107,7 +145,59 @@ func (o *Service) CreatePolicy(
 	rules []byte,
 	name string,
 ) (*Policy, error) {
-	postURI := o.EndPointURI.JoinPath("policy", scheme)
+	return o.CreatePolicyContext(context.Background(), scheme, ct, rules, name)
+}
+
+// CreatePolicyContext is like CreatePolicy but binds the request to the
+// supplied context.
+func (o *Service) CreatePolicyContext(
+	ctx context.Context,
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+) (*Policy, error) {
+	return o.CreateSignedPolicyContext(ctx, scheme, ct, rules, name, nil)
+}
+
+// CreateSignedPolicy is like CreatePolicy, but also supplies the detached
+// signatures of the policy (see SignPolicy). If the Service has a
+// PolicyVerifier, the policy is only created if its signatures satisfy it.
+func (o *Service) CreateSignedPolicy(
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+	signatures []string,
+) (*Policy, error) {
+	return o.CreateSignedPolicyContext(context.Background(), scheme, ct, rules, name, signatures)
+}
+
+// CreateSignedPolicyContext is like CreateSignedPolicy but binds the request
+// to the supplied context.
+func (o *Service) CreateSignedPolicyContext(
+	ctx context.Context,
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+	signatures []string,
+) (*Policy, error) {
+	if o.PolicyVerifier != nil {
+		typ, err := policyTypeFor(ct)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := o.PolicyVerifier.Verify(scheme, name, typ, rules, signatures); err != nil {
+			return nil, fmt.Errorf("refusing to create policy: %w", err)
+		}
+	}
+
+	postURI, err := o.endpointURI(CreatePolicyEndpoint, scheme)
+	if err != nil {
+		return nil, err
+	}
 
 	qvals := url.Values{}
 	if name != "" {
@@ -115,7 +205,7 @@ func (o *Service) CreatePolicy(
 	}
 	postURI.RawQuery = qvals.Encode()
 
-	res, err := o.Client.PostResource(rules, ct, PolicyMediaType, postURI.String())
+	res, err := o.Client.PostResourceContext(ctx, rules, ct, PolicyMediaType, postURI.String())
 	if err != nil {
 		return nil, fmt.Errorf("post request failed: %w", err)
 	}
@@ -131,9 +221,57 @@ func (o *Service) CreatePolicy(
 // associated with the specified scheme. This deactivates any previously-active
 // policy.
 func (o *Service) ActivatePolicy(scheme string, policyID uuid.UUID) error {
-	postURI := o.EndPointURI.JoinPath("policy", scheme, policyID.String(), "activate")
+	return o.ActivatePolicyContext(context.Background(), scheme, policyID)
+}
+
+// ActivatePolicyContext is like ActivatePolicy but binds the request to the
+// supplied context.
+func (o *Service) ActivatePolicyContext(
+	ctx context.Context,
+	scheme string,
+	policyID uuid.UUID,
+) error {
+	return o.ActivateSignedPolicyContext(ctx, scheme, policyID, nil)
+}
+
+// ActivateSignedPolicy is like ActivatePolicy, but also supplies the detached
+// signatures of the policy (see SignPolicy). If the Service has a
+// PolicyVerifier, the policy is retrieved and only activated if the
+// signatures over its rules, as stored by the service, satisfy the verifier.
+func (o *Service) ActivateSignedPolicy(
+	scheme string,
+	policyID uuid.UUID,
+	signatures []string,
+) error {
+	return o.ActivateSignedPolicyContext(context.Background(), scheme, policyID, signatures)
+}
 
-	res, err := o.Client.PostEmptyResource(PolicyMediaType, postURI.String())
+// ActivateSignedPolicyContext is like ActivateSignedPolicy but binds the
+// requests to the supplied context.
+func (o *Service) ActivateSignedPolicyContext(
+	ctx context.Context,
+	scheme string,
+	policyID uuid.UUID,
+	signatures []string,
+) error {
+	if o.PolicyVerifier != nil {
+		p, err := o.GetPolicyContext(ctx, scheme, policyID)
+		if err != nil {
+			return fmt.Errorf("retrieving policy %s: %w", policyID, err)
+		}
+
+		err = o.PolicyVerifier.Verify(scheme, p.Name, p.Type, []byte(p.Rules), signatures)
+		if err != nil {
+			return fmt.Errorf("refusing to activate policy %s: %w", policyID, err)
+		}
+	}
+
+	postURI, err := o.endpointURI(ActivatePolicyEndpoint, scheme, policyID.String())
+	if err != nil {
+		return err
+	}
+
+	res, err := o.Client.PostEmptyResourceContext(ctx, PolicyMediaType, postURI.String())
 	if err != nil {
 		return fmt.Errorf("post request failed: %w", err)
 	}
@@ -148,9 +286,18 @@ func (o *Service) ActivatePolicy(scheme string, policyID uuid.UUID) error {
 // DeactivateAllPolicies deactivates all policies associated with the specified
 // scheme.
 func (o *Service) DeactivateAllPolicies(scheme string) error {
-	postURI := o.EndPointURI.JoinPath("policies", scheme, "deactivate")
+	return o.DeactivateAllPoliciesContext(context.Background(), scheme)
+}
+
+// DeactivateAllPoliciesContext is like DeactivateAllPolicies but binds the
+// request to the supplied context.
+func (o *Service) DeactivateAllPoliciesContext(ctx context.Context, scheme string) error {
+	postURI, err := o.endpointURI(DeactivatePoliciesEndpoint, scheme)
+	if err != nil {
+		return err
+	}
 
-	res, err := o.Client.PostEmptyResource(PolicyMediaType, postURI.String())
+	res, err := o.Client.PostEmptyResourceContext(ctx, PolicyMediaType, postURI.String())
 	if err != nil {
 		return fmt.Errorf("post request failed: %w", err)
 	}
@@ -165,15 +312,24 @@ func (o *Service) DeactivateAllPolicies(scheme string) error {
 // GetActivePolicy returns the currently active policy for the specified
 // scheme. If no such policy exists, an error is returned.
 func (o *Service) GetActivePolicy(scheme string) (*Policy, error) {
-	getURI := o.EndPointURI.JoinPath("policy", scheme)
+	return o.GetActivePolicyContext(context.Background(), scheme)
+}
+
+// GetActivePolicyContext is like GetActivePolicy but binds the request to the
+// supplied context.
+func (o *Service) GetActivePolicyContext(ctx context.Context, scheme string) (*Policy, error) {
+	getURI, err := o.endpointURI(GetActivePolicyEndpoint, scheme)
+	if err != nil {
+		return nil, err
+	}
 
-	res, err := o.Client.GetResource(PolicyMediaType, getURI.String())
+	res, err := o.Client.GetResourceContext(ctx, PolicyMediaType, getURI.String())
 	if err != nil {
 		return nil, fmt.Errorf("get request failed: %w", err)
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected HTTP response code %d", res.StatusCode)
+	if err := common.CheckResponse(res, http.StatusOK); err != nil {
+		return nil, err
 	}
 
 	return policyFromResponse(res)
@@ -182,9 +338,22 @@ func (o *Service) GetActivePolicy(scheme string) (*Policy, error) {
 // GetPolicy returns the policy with the specified UUID associated with the
 // specified scheme.
 func (o *Service) GetPolicy(scheme string, policyID uuid.UUID) (*Policy, error) {
-	getURI := o.EndPointURI.JoinPath("policy", scheme, policyID.String())
+	return o.GetPolicyContext(context.Background(), scheme, policyID)
+}
 
-	res, err := o.Client.GetResource(PolicyMediaType, getURI.String())
+// GetPolicyContext is like GetPolicy but binds the request to the supplied
+// context.
+func (o *Service) GetPolicyContext(
+	ctx context.Context,
+	scheme string,
+	policyID uuid.UUID,
+) (*Policy, error) {
+	getURI, err := o.endpointURI(GetPolicyEndpoint, scheme, policyID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := o.Client.GetResourceContext(ctx, PolicyMediaType, getURI.String())
 	if err != nil {
 		return nil, fmt.Errorf("get request failed: %w", err)
 	}
@@ -200,7 +369,20 @@ func (o *Service) GetPolicy(scheme string, policyID uuid.UUID) (*Policy, error)
 // the name is specified as something other than "", only policies with that
 // name are returned.
 func (o *Service) GetPolicies(scheme string, name string) ([]*Policy, error) {
-	getURI := o.EndPointURI.JoinPath("policies", scheme)
+	return o.GetPoliciesContext(context.Background(), scheme, name)
+}
+
+// GetPoliciesContext is like GetPolicies but binds the request to the supplied
+// context.
+func (o *Service) GetPoliciesContext(
+	ctx context.Context,
+	scheme string,
+	name string,
+) ([]*Policy, error) {
+	getURI, err := o.endpointURI(GetPoliciesEndpoint, scheme)
+	if err != nil {
+		return nil, err
+	}
 
 	qvals := url.Values{}
 	if name != "" {
@@ -208,7 +390,7 @@ func (o *Service) GetPolicies(scheme string, name string) ([]*Policy, error) {
 	}
 	getURI.RawQuery = qvals.Encode()
 
-	res, err := o.Client.GetResource(PoliciesMediaType, getURI.String())
+	res, err := o.Client.GetResourceContext(ctx, PoliciesMediaType, getURI.String())
 	if err != nil {
 		return nil, fmt.Errorf("get request failed: %w", err)
 	}
@@ -220,38 +402,223 @@ func (o *Service) GetPolicies(scheme string, name string) ([]*Policy, error) {
 	return policiesFromResponse(res)
 }
 
-// GetSupportedSchemes returns a []string with the names of schemes supported
-// by the service.
-func (o *Service) GetSupportedSchemes() ([]string, error) {
-	wellKnownURI := &url.URL{
-		Scheme: o.EndPointURI.Scheme,
-		Host:   o.EndPointURI.Host,
-		Path:   WellKnownPath,
+// DeletePolicy deletes the policy with the specified UUID associated with the
+// specified scheme.
+func (o *Service) DeletePolicy(scheme string, policyID uuid.UUID) error {
+	return o.DeletePolicyContext(context.Background(), scheme, policyID)
+}
+
+// DeletePolicyContext is like DeletePolicy but binds the request to the
+// supplied context.
+func (o *Service) DeletePolicyContext(
+	ctx context.Context,
+	scheme string,
+	policyID uuid.UUID,
+) error {
+	deleteURI, err := o.endpointURI(DeletePolicyEndpoint, scheme, policyID.String())
+	if err != nil {
+		return err
 	}
 
-	res, err := o.Client.GetResource(WellKnownMediaType, wellKnownURI.String())
+	if err := o.Client.DeleteResourceContext(ctx, deleteURI.String()); err != nil {
+		return fmt.Errorf("delete request failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePolicies deletes all the policies associated with the specified
+// scheme. If the name is specified as something other than "", only policies
+// with that name are deleted.
+func (o *Service) DeletePolicies(scheme string, name string) error {
+	return o.DeletePoliciesContext(context.Background(), scheme, name)
+}
+
+// DeletePoliciesContext is like DeletePolicies but binds the request to the
+// supplied context.
+func (o *Service) DeletePoliciesContext(
+	ctx context.Context,
+	scheme string,
+	name string,
+) error {
+	deleteURI, err := o.endpointURI(DeletePoliciesEndpoint, scheme)
 	if err != nil {
-		return nil, fmt.Errorf("get request failed: %w", err)
+		return err
 	}
 
-	if err := common.CheckResponse(res, http.StatusOK); err != nil {
-		return nil, err
+	qvals := url.Values{}
+	if name != "" {
+		qvals.Add("name", name)
 	}
+	deleteURI.RawQuery = qvals.Encode()
 
-	var schemesInfo struct {
-		Schemes []string `json:"attestation-schemes"`
+	if err := o.Client.DeleteResourceContext(ctx, deleteURI.String()); err != nil {
+		return fmt.Errorf("delete request failed: %w", err)
 	}
 
-	if err := common.DecodeJSONBody(res, &schemesInfo); err != nil {
+	return nil
+}
+
+// UpdateOPAPolicy is a wrapper around UpdatePolicy that assumes the OPA media
+// type.
+func (o *Service) UpdateOPAPolicy(
+	scheme string,
+	rules []byte,
+	name string,
+	activate bool,
+) (*Policy, error) {
+	return o.UpdateOPAPolicyContext(context.Background(), scheme, rules, name, activate)
+}
+
+// UpdateOPAPolicyContext is like UpdateOPAPolicy but binds the requests to the
+// supplied context.
+func (o *Service) UpdateOPAPolicyContext(
+	ctx context.Context,
+	scheme string,
+	rules []byte,
+	name string,
+	activate bool,
+) (*Policy, error) {
+	return o.UpdatePolicyContext(ctx, scheme, OPARulesMediaType, rules, name, activate)
+}
+
+// UpdatePolicy replaces the rules of the named policy associated with the
+// specified scheme by creating a new version of it. If activate is true, the
+// new version is also activated; should the activation fail, the new version
+// is deleted again, so that either both steps take effect or neither does.
+// If the outcome of the activation cannot be determined (e.g., because the
+// active policy cannot be retrieved after the activation request failed), the
+// new version is not deleted, and the returned error names it so that it can
+// be inspected and cleaned up.
+func (o *Service) UpdatePolicy(
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+	activate bool,
+) (*Policy, error) {
+	return o.UpdatePolicyContext(context.Background(), scheme, ct, rules, name, activate)
+}
+
+// UpdatePolicyContext is like UpdatePolicy but binds the requests to the
+// supplied context.
+func (o *Service) UpdatePolicyContext(
+	ctx context.Context,
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+	activate bool,
+) (*Policy, error) {
+	return o.UpdateSignedPolicyContext(ctx, scheme, ct, rules, name, activate, nil)
+}
+
+// UpdateSignedPolicy is like UpdatePolicy, but also supplies the detached
+// signatures of the new policy version (see SignPolicy), which are checked
+// against the PolicyVerifier of the Service, if any, both on creation and on
+// activation.
+func (o *Service) UpdateSignedPolicy(
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+	activate bool,
+	signatures []string,
+) (*Policy, error) {
+	return o.UpdateSignedPolicyContext(
+		context.Background(), scheme, ct, rules, name, activate, signatures,
+	)
+}
+
+// UpdateSignedPolicyContext is like UpdateSignedPolicy but binds the requests
+// to the supplied context.
+func (o *Service) UpdateSignedPolicyContext(
+	ctx context.Context,
+	scheme string,
+	ct string,
+	rules []byte,
+	name string,
+	activate bool,
+	signatures []string,
+) (*Policy, error) {
+	if name == "" {
+		return nil, errors.New("the name of the policy to update must be specified")
+	}
+
+	policy, err := o.CreateSignedPolicyContext(ctx, scheme, ct, rules, name, signatures)
+	if err != nil {
+		return nil, fmt.Errorf("creating new policy version: %w", err)
+	}
+
+	if !activate {
+		return policy, nil
+	}
+
+	if err := o.ActivateSignedPolicyContext(ctx, scheme, policy.UUID, signatures); err != nil {
+		return o.rollbackUpdate(ctx, scheme, policy, err)
+	}
+
+	policy.Active = true
+
+	return policy, nil
+}
+
+// rollbackUpdate deletes the new policy version created by
+// UpdateSignedPolicyContext after actErr made its activation fail. The
+// requests are bound to a context detached from ctx, in case ctx is what made
+// the activation fail.
+//
+// Since a failed activation request may still have taken effect, the active
+// policy is looked up first: if it turns out to be the new version, the update
+// is reported as successful; if it cannot be determined, the new version is
+// left in place, since deleting the active policy would leave the scheme
+// without one, and an error naming it is returned.
+func (o *Service) rollbackUpdate(
+	ctx context.Context,
+	scheme string,
+	policy *Policy,
+	actErr error,
+) (*Policy, error) {
+	cleanupCtx, cancel := context.WithTimeout(common.WithoutCancel(ctx), common.CleanupTimeout)
+	defer cancel()
+
+	active, err := o.GetActivePolicyContext(cleanupCtx, scheme)
+	switch {
+	case err == nil && active.UUID == policy.UUID:
+		policy.Active = true
+		return policy, nil
+	case err != nil && !errors.Is(err, common.ErrNotFound):
+		return nil, fmt.Errorf(
+			"activating new policy version: %w (%s not rolled back, cannot determine the active policy: %v)",
+			actErr, policy.UUID, err,
+		)
+	}
+
+	if err := o.DeletePolicyContext(cleanupCtx, scheme, policy.UUID); err != nil {
 		return nil, fmt.Errorf(
-			"could not decode well-known info response (status %d): %w",
-			res.StatusCode,
-			err,
+			"activating new policy version: %w (rollback of %s failed: %v)",
+			actErr, policy.UUID, err,
 		)
 	}
 
-	return schemesInfo.Schemes, nil
+	return nil, fmt.Errorf("activating new policy version: %w", actErr)
+}
+
+// GetSupportedSchemes returns a []string with the names of schemes supported
+// by the service.
+func (o *Service) GetSupportedSchemes() ([]string, error) {
+	return o.GetSupportedSchemesContext(context.Background())
+}
+
+// GetSupportedSchemesContext is like GetSupportedSchemes but binds the request
+// to the supplied context.
+func (o *Service) GetSupportedSchemesContext(ctx context.Context) ([]string, error) {
+	info, err := o.GetServiceInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	return info.AttestationSchemes, nil
 }
 
 func policyFromResponse(res *http.Response) (*Policy, error) {
@@ -1,9 +1,11 @@
 package management
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
@@ -185,6 +187,28 @@ func TestService_GetActivePolicy(t *testing.T) {
 	assert.Equal(t, pol.UUID, testPolicy.UUID)
 }
 
+func TestService_GetActivePolicy_not_found(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		_, err := w.Write([]byte(`{"title": "Not Found", "status": 404, "detail": "no active policy"}`))
+		assert.NoError(t, err)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+	}
+
+	_, err := service.GetActivePolicy("test_scheme")
+	assert.EqualError(t, err, "404 Not Found: no active policy")
+	assert.ErrorIs(t, err, common.ErrNotFound)
+	assert.NotErrorIs(t, err, common.ErrServerError)
+}
+
 func TestService_GetPolicy(t *testing.T) {
 	expectedURI := testEndpointURI.JoinPath("policy", "test_scheme", testPolicy.UUID.String())
 
@@ -231,7 +255,8 @@ func TestService_GetPolicy(t *testing.T) {
 
 	test = "server-error"
 	_, err = service.GetPolicy("test_scheme", testPolicy.UUID)
-	assert.Contains(t, err.Error(), "unexpected HTTP response code 500")
+	assert.EqualError(t, err, "500 Internal Server Error")
+	assert.ErrorIs(t, err, common.ErrServerError)
 }
 
 func TestService_GetPolicies(t *testing.T) {
@@ -282,7 +307,7 @@ func TestService_GetPolicies(t *testing.T) {
 
 	test = "server-error"
 	_, err = service.GetPolicies("test_scheme", "test_name")
-	assert.Contains(t, err.Error(), "unexpected HTTP response code 500")
+	assert.EqualError(t, err, "500 Internal Server Error")
 }
 
 func TestService_GetSupportedSchemes(t *testing.T) {
@@ -341,7 +366,45 @@ func TestService_GetSupportedSchemes(t *testing.T) {
 
 	test = "server-error"
 	_, err = service.GetSupportedSchemes()
-	assert.Contains(t, err.Error(), "unexpected HTTP response code 500")
+	assert.EqualError(t, err, "500 Internal Server Error")
+}
+
+func TestService_Context_cancelled(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Fail(t, "unexpected request")
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := service.CreateOPAPolicyContext(ctx, "test_scheme", []byte{}, "test_name")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = service.ActivatePolicyContext(ctx, "test_scheme", uuid.New())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = service.DeactivateAllPoliciesContext(ctx, "test_scheme")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = service.GetActivePolicyContext(ctx, "test_scheme")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = service.GetPolicyContext(ctx, "test_scheme", uuid.New())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = service.GetPoliciesContext(ctx, "test_scheme", "")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = service.GetSupportedSchemesContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
 }
 
 func toBytes(in interface{}) []byte {
@@ -351,3 +414,337 @@ func toBytes(in interface{}) []byte {
 	}
 	return b
 }
+
+func TestService_GetServiceInfo(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, WellKnownMediaType, r.Header.Get("Accept"))
+		assert.Equal(t, testWellKnownURI.RequestURI(), r.RequestURI)
+
+		w.Header().Add("Content-Type", WellKnownMediaType)
+		w.WriteHeader(http.StatusOK)
+
+		wellKnownInfo := `
+		{
+		    "version": "commit-cb11fa0",
+		    "service-state": "READY",
+		    "attestation-schemes": ["scheme1"],
+		    "media-types": ["application/vnd.veraison.policy.opa"],
+		    "api-endpoints": {
+			"createPolicy": "/mgmt/v2/policy/:scheme",
+			"getPolicy": "/mgmt/v2/policy/:scheme/:uuid"
+		    }
+		}
+		`
+		_, err := w.Write([]byte(wellKnownInfo))
+		assert.NoError(t, err)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+	}
+
+	info, err := service.GetServiceInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "commit-cb11fa0", info.Version)
+	assert.True(t, info.IsReady())
+	assert.Equal(t, []string{"scheme1"}, info.AttestationSchemes)
+	assert.Equal(t, []string{OPARulesMediaType}, info.MediaTypes)
+	assert.Equal(t, "/mgmt/v2/policy/:scheme", info.APIEndpoints[CreatePolicyEndpoint])
+
+	// GetServiceInfo does not change the endpoints in use...
+	assert.Nil(t, service.Endpoints)
+
+	// ...Discover does
+	_, err = service.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, info.APIEndpoints, service.Endpoints)
+}
+
+func TestService_endpointURI(t *testing.T) {
+	id := uuid.New().String()
+
+	service := Service{EndPointURI: testEndpointURI}
+
+	u, err := service.endpointURI(ActivatePolicyEndpoint, "test_scheme", id)
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/management/v1/policy/test_scheme/"+id+"/activate", u.String())
+
+	service.Endpoints = map[string]string{
+		CreatePolicyEndpoint: "/mgmt/v2/policy/:scheme",
+		GetPoliciesEndpoint:  "all/:scheme",
+	}
+
+	u, err = service.endpointURI(CreatePolicyEndpoint, "test_scheme")
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/mgmt/v2/policy/test_scheme", u.String())
+
+	u, err = service.endpointURI(GetPoliciesEndpoint, "test_scheme")
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/management/v1/all/test_scheme", u.String())
+
+	// not advertised, falls back to the default
+	u, err = service.endpointURI(GetPolicyEndpoint, "test_scheme", id)
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/management/v1/policy/test_scheme/"+id, u.String())
+
+	_, err = service.endpointURI("nonExistent", "test_scheme")
+	assert.EqualError(t, err, `no path for endpoint "nonExistent"`)
+
+	// values cannot escape their path segment
+	u, err = service.endpointURI(CreatePolicyEndpoint, "a/b?c#d")
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/mgmt/v2/policy/a%2Fb%3Fc%23d", u.String())
+	assert.Empty(t, u.RawQuery)
+
+	u, err = service.endpointURI(GetPolicyEndpoint, "a/b", id)
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/management/v1/policy/a%2Fb/"+id, u.String())
+
+	u, err = service.endpointURI(GetPoliciesEndpoint, "a b")
+	require.NoError(t, err)
+	assert.Equal(t, "http://veraison.example/management/v1/all/a%20b", u.String())
+
+	_, err = service.endpointURI(GetPoliciesEndpoint, "..")
+	assert.EqualError(t, err, `invalid scheme ".."`)
+}
+
+func TestService_CreateOPAPolicy_discovered_endpoint(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/mgmt/v2/policy/test_scheme?name=test_name", r.RequestURI)
+
+		w.Header().Add("Content-Type", PolicyMediaType)
+		w.WriteHeader(http.StatusCreated)
+		_, err := w.Write(toBytes(testPolicy))
+		assert.NoError(t, err)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+		Endpoints:   map[string]string{CreatePolicyEndpoint: "/mgmt/v2/policy/:scheme"},
+	}
+
+	_, err := service.CreateOPAPolicy("test_scheme", []byte{}, "test_name")
+	require.NoError(t, err)
+}
+
+func TestService_DeletePolicy(t *testing.T) {
+	id := uuid.New()
+
+	expectedURI := testEndpointURI.JoinPath("policy", "test_scheme", id.String())
+
+	status := http.StatusNoContent
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, expectedURI.RequestURI(), r.RequestURI)
+
+		if status == http.StatusNotFound {
+			w.Header().Add("Content-Type", "application/problem+json")
+			w.WriteHeader(status)
+			_, err := w.Write([]byte(`{"title": "Not Found", "status": 404, "detail": "no such policy"}`))
+			assert.NoError(t, err)
+			return
+		}
+
+		w.WriteHeader(status)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+	}
+
+	err := service.DeletePolicy("test_scheme", id)
+	require.NoError(t, err)
+
+	status = http.StatusNotFound
+	err = service.DeletePolicy("test_scheme", id)
+	assert.EqualError(t, err, "delete request failed: 404 Not Found: no such policy")
+
+	var prob *common.ProblemError
+	assert.ErrorAs(t, err, &prob)
+	assert.ErrorIs(t, err, common.ErrNotFound)
+
+	status = http.StatusInternalServerError
+	err = service.DeletePolicy("test_scheme", id)
+	assert.EqualError(t, err, "delete request failed: 500 Internal Server Error")
+	assert.ErrorIs(t, err, common.ErrServerError)
+}
+
+func TestService_DeletePolicies(t *testing.T) {
+	var expectedURI string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, expectedURI, r.RequestURI)
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+	}
+
+	expectedURI = "/management/v1/policies/test_scheme?name=test_name"
+	err := service.DeletePolicies("test_scheme", "test_name")
+	require.NoError(t, err)
+
+	expectedURI = "/management/v1/policies/test_scheme"
+	err = service.DeletePolicies("test_scheme", "")
+	require.NoError(t, err)
+}
+
+func TestService_UpdatePolicy(t *testing.T) {
+	var (
+		activationStatus int
+		activePolicy     *Policy
+		activeStatus     int
+		requests         []string
+	)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.Method {
+		case http.MethodGet:
+			if activeStatus != http.StatusOK {
+				w.WriteHeader(activeStatus)
+				return
+			}
+			w.Header().Add("Content-Type", PolicyMediaType)
+			w.WriteHeader(http.StatusOK)
+			_, err := w.Write(toBytes(activePolicy))
+			assert.NoError(t, err)
+		case http.MethodPost:
+			if r.URL.Path == "/management/v1/policy/test_scheme" {
+				assert.Equal(t, "name=test_name", r.URL.RawQuery)
+				w.Header().Add("Content-Type", PolicyMediaType)
+				w.WriteHeader(http.StatusCreated)
+				_, err := w.Write(toBytes(testPolicy))
+				assert.NoError(t, err)
+				return
+			}
+			w.WriteHeader(activationStatus)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			require.Fail(t, "unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	service := Service{
+		EndPointURI: testEndpointURI,
+		Client:      client,
+	}
+
+	createURI := "POST /management/v1/policy/test_scheme"
+	activateURI := "POST /management/v1/policy/test_scheme/" + testPolicy.UUID.String() + "/activate"
+	deleteURI := "DELETE /management/v1/policy/test_scheme/" + testPolicy.UUID.String()
+	getActiveURI := "GET /management/v1/policy/test_scheme"
+
+	// update without activation
+	pol, err := service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "test_name", false)
+	require.NoError(t, err)
+	assert.False(t, pol.Active)
+	assert.Equal(t, []string{createURI}, requests)
+
+	// update with activation
+	requests = nil
+	activationStatus = http.StatusOK
+
+	pol, err = service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "test_name", true)
+	require.NoError(t, err)
+	assert.True(t, pol.Active)
+	assert.Equal(t, []string{createURI, activateURI}, requests)
+
+	// failed activation rolls back the new version
+	requests = nil
+	activationStatus = http.StatusInternalServerError
+	activeStatus = http.StatusOK
+	activePolicy = &Policy{UUID: uuid.New(), Name: "test_name", Active: true}
+
+	_, err = service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "test_name", true)
+	assert.EqualError(t, err, "activating new policy version: 500 Internal Server Error")
+	assert.Equal(t, []string{createURI, activateURI, getActiveURI, deleteURI}, requests)
+
+	// ... also if there is no active policy at all
+	requests = nil
+	activeStatus = http.StatusNotFound
+
+	_, err = service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "test_name", true)
+	assert.EqualError(t, err, "activating new policy version: 500 Internal Server Error")
+	assert.Equal(t, []string{createURI, activateURI, getActiveURI, deleteURI}, requests)
+
+	// a failed activation that took effect regardless is not rolled back
+	requests = nil
+	activeStatus = http.StatusOK
+	activePolicy = testPolicy
+
+	pol, err = service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "test_name", true)
+	require.NoError(t, err)
+	assert.True(t, pol.Active)
+	assert.Equal(t, []string{createURI, activateURI, getActiveURI}, requests)
+
+	// if the active policy cannot be determined, the new version is kept
+	requests = nil
+	activeStatus = http.StatusServiceUnavailable
+
+	_, err = service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "test_name", true)
+	assert.EqualError(t, err, "activating new policy version: 500 Internal Server Error ("+
+		testPolicy.UUID.String()+" not rolled back, cannot determine the active policy: 503 Service Unavailable)")
+	assert.Equal(t, []string{createURI, activateURI, getActiveURI}, requests)
+
+	_, err = service.UpdateOPAPolicy("test_scheme", []byte("new rules"), "", true)
+	assert.EqualError(t, err, "the name of the policy to update must be specified")
+}
+
+func TestService_UpdatePolicyContext_cancelled_rolls_back(t *testing.T) {
+	store := newTestPolicyStore(t)
+	previous := store.add("test_scheme", "test_name", "old rules", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, teardown := common.NewTestingHTTPClient(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/activate") {
+				cancel()
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			store.ServeHTTP(w, r)
+		},
+	))
+	defer teardown()
+
+	service := Service{EndPointURI: testEndpointURI, Client: client}
+
+	_, err := service.UpdateOPAPolicyContext(ctx, "test_scheme", []byte("new rules"), "test_name", true)
+	assert.Error(t, err)
+
+	require.Len(t, store.requests, 2)
+	assert.Equal(t, "POST policy/test_scheme", store.requests[0])
+	assert.Regexp(t, `^DELETE policy/test_scheme/`, store.requests[1])
+	assert.True(t, previous.Active)
+	assert.Len(t, store.policies["test_scheme"], 1)
+}
@@ -0,0 +1,373 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package opa compiles and evaluates Veraison OPA policies locally, so that
+// they can be checked before being uploaded with the management package. It
+// is kept apart from management so that only the clients that need it pull
+// in the OPA dependencies.
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/veraison/apiclient/verification/ear"
+)
+
+// PolicyPackage is the Rego package OPA policies must belong to in order to
+// be evaluated by the Veraison services.
+const PolicyPackage = "policy"
+
+// opaPreamble is evaluated alongside the policy rules, as done by the
+// Veraison services. It provides the trust claim constants policies can
+// refer to, and gathers the rules a policy may define into the outcome
+// query.
+//
+// It is copied from policy/opa/preamble.rego in github.com/veraison/services
+// and tracks the version of the services exposing the v1 management API
+// (/management/v1), which is the one this client talks to. It must be kept in
+// sync with that file whenever the services change how policies are
+// evaluated.
+const opaPreamble = `package policy
+
+MISSING := "MISSING"
+
+NO_CLAIM := 0
+UNEXPECTED_ERROR := 1
+CRYPTO_VALIDATION_FAILED := 99
+
+TRUSTWORTHY_INSTANCE := 2
+UNTRUSTWORTHY_INSTANCE := 96
+UNRECOGNIZED_INSTANCE := 97
+
+APPROVED_CONFIG := 2
+NO_CONFIG_VULNS := 3
+UNSAFE_CONFIG := 32
+UNSUPPORTABLE_CONFIG := 96
+
+APPROVED_RUNTIME := 2
+APPROVED_BOOT := 3
+UNRECOGNIZED_RUNTIME := 33
+CONTRAINDICATED_RUNTIME := 96
+
+APPROVED_FILES := 2
+UNRECOGNIZED_FILES := 32
+CONTRAINDICATED_FILES := 96
+
+GENUINE_HARDWARE := 2
+UNSAFE_HARDWARE := 32
+CONTRAINDICATED_HARDWARE := 96
+UNRECOGNIZED_HARDWARE := 97
+
+ENCRYPTED_MEMORY_RUNTIME := 2
+ISOLATED_MEMORY_RUNTIME := 32
+VISIBLE_MEMORY_RUNTIME := 96
+
+HW_KEYS_ENCRYPTED_SECRETS := 2
+SW_KEYS_ENCRYPTED_SECRETS := 32
+UNENCRYPTED_SECRETS := 96
+
+TRUSTED_SOURCES := 2
+UNTRUSTED_SOURCES := 32
+CONTRAINDICATED_SOURCES := 96
+
+default status = "MISSING"
+default instance_identity = "MISSING"
+default configuration = "MISSING"
+default executables = "MISSING"
+default file_system = "MISSING"
+default hardware = "MISSING"
+default runtime_opaque = "MISSING"
+default storage_opaque = "MISSING"
+default sourced_data = "MISSING"
+default added_claims = "MISSING"
+
+outcome := {
+	"ear.status": status,
+	"ear.trustworthiness-vector": {
+		"instance-identity": instance_identity,
+		"configuration": configuration,
+		"executables": executables,
+		"file-system": file_system,
+		"hardware": hardware,
+		"runtime-opaque": runtime_opaque,
+		"storage-opaque": storage_opaque,
+		"sourced-data": sourced_data,
+	},
+	"ear.veraison.policy-claims": added_claims,
+}
+`
+
+// Policy is an OPA policy compiled locally, ready to be evaluated against
+// sample appraisals.
+type Policy struct {
+	query rego.PreparedEvalQuery
+}
+
+// Validate compiles the supplied Rego rules the way the Veraison services
+// would, without uploading them. It returns an error describing any syntax
+// or semantic problem found.
+func Validate(rules []byte) error {
+	_, err := Compile(rules)
+	return err
+}
+
+// Compile compiles the supplied Rego rules into a Policy. The rules must
+// belong to the PolicyPackage package.
+func Compile(rules []byte) (*Policy, error) {
+	module, err := ast.ParseModule("policy.rego", string(rules))
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	if module == nil {
+		return nil, errors.New("parsing policy: empty module")
+	}
+
+	if pkg := module.Package.Path.String(); pkg != "data."+PolicyPackage {
+		return nil, fmt.Errorf(
+			"policy package must be %q, got %q",
+			PolicyPackage, pkg[len("data."):],
+		)
+	}
+
+	query, err := rego.New(
+		rego.Query("data."+PolicyPackage+".outcome"),
+		rego.Module("preamble.rego", opaPreamble),
+		rego.Module("policy.rego", string(rules)),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("compiling policy: %w", err)
+	}
+
+	return &Policy{query: query}, nil
+}
+
+// Input is the appraisal context an OPA policy is evaluated against.
+type Input struct {
+	// Scheme is the attestation scheme the evidence belongs to.
+	Scheme string
+
+	// Evidence contains the claims extracted from the evidence.
+	Evidence map[string]interface{}
+
+	// Endorsements contains the endorsements matched to the evidence.
+	Endorsements []interface{}
+
+	// Result is the draft appraisal produced by the scheme before the
+	// policy is applied.
+	Result *ear.Appraisal
+}
+
+// TrustClaimChange records the policy-driven update of one component of the
+// trustworthiness vector. From and To are nil if the component is unset
+// respectively before and after the policy is applied.
+type TrustClaimChange struct {
+	Claim string
+	From  *ear.TrustClaim
+	To    *ear.TrustClaim
+}
+
+// Evaluation is the outcome of evaluating an OPA policy.
+type Evaluation struct {
+	// Before is the draft appraisal the policy was evaluated against.
+	Before *ear.Appraisal
+
+	// After is the appraisal updated with the policy outcome.
+	After *ear.Appraisal
+
+	// Changes lists the trustworthiness vector components updated by the
+	// policy, sorted by claim name.
+	Changes []TrustClaimChange
+}
+
+// StatusChanged returns whether the policy updated the "ear.status" claim.
+func (o Evaluation) StatusChanged() bool {
+	return o.Before.Status != o.After.Status
+}
+
+// Evaluate is a convenience wrapper around Compile and Policy.Evaluate.
+func Evaluate(
+	ctx context.Context,
+	rules []byte,
+	input Input,
+) (*Evaluation, error) {
+	policy, err := Compile(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy.Evaluate(ctx, input)
+}
+
+// Evaluate evaluates the policy against the supplied input, returning the
+// appraisal updated the way the Veraison services would. Trustworthiness
+// vector components set by the policy replace those of the draft appraisal.
+// Unless explicitly set by the policy, the resulting status is the least
+// favourable tier across the updated vector.
+func (o *Policy) Evaluate(ctx context.Context, input Input) (*Evaluation, error) {
+	before := input.Result
+	if before == nil {
+		before = &ear.Appraisal{}
+	}
+
+	regoInput, err := input.toRego(before)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := o.query.Eval(ctx, rego.EvalInput(regoInput))
+	if err != nil {
+		return nil, fmt.Errorf("evaluating policy: %w", err)
+	}
+
+	if len(rs) != 1 || len(rs[0].Expressions) != 1 {
+		return nil, errors.New("evaluating policy: policy produced no outcome")
+	}
+
+	var out opaOutcome
+	if err := remarshal(rs[0].Expressions[0].Value, &out); err != nil {
+		return nil, fmt.Errorf("decoding policy outcome: %w", err)
+	}
+
+	return out.apply(before)
+}
+
+func (o Input) toRego(result *ear.Appraisal) (map[string]interface{}, error) {
+	var resultMap map[string]interface{}
+	if err := remarshal(result, &resultMap); err != nil {
+		return nil, fmt.Errorf("encoding draft appraisal: %w", err)
+	}
+
+	evidence := o.Evidence
+	if evidence == nil {
+		evidence = map[string]interface{}{}
+	}
+
+	endorsements := o.Endorsements
+	if endorsements == nil {
+		endorsements = []interface{}{}
+	}
+
+	return map[string]interface{}{
+		"scheme":       o.Scheme,
+		"evidence":     evidence,
+		"endorsements": endorsements,
+		"result":       resultMap,
+	}, nil
+}
+
+// opaOutcome is the value of the outcome query of the preamble. Rules left
+// undefined by the policy evaluate to the MISSING string.
+type opaOutcome struct {
+	Status       interface{}            `json:"ear.status"`
+	TrustVector  map[string]interface{} `json:"ear.trustworthiness-vector"`
+	PolicyClaims interface{}            `json:"ear.veraison.policy-claims"`
+}
+
+func (o opaOutcome) apply(before *ear.Appraisal) (*Evaluation, error) {
+	var after ear.Appraisal
+	if err := remarshal(before, &after); err != nil {
+		return nil, fmt.Errorf("copying draft appraisal: %w", err)
+	}
+
+	var oldClaims map[string]ear.TrustClaim
+	if before.TrustVector != nil {
+		oldClaims = before.TrustVector.Claims()
+	}
+
+	newClaims := map[string]interface{}{}
+	for name, c := range oldClaims {
+		newClaims[name] = c
+	}
+
+	var changes []TrustClaimChange
+
+	for name, v := range o.TrustVector {
+		if isMissing(v) {
+			continue
+		}
+
+		c, err := toTrustClaim(v)
+		if err != nil {
+			return nil, fmt.Errorf("policy outcome: %q: %w", name, err)
+		}
+
+		newClaims[name] = c
+
+		if old, ok := oldClaims[name]; ok && old == c {
+			continue
+		}
+
+		change := TrustClaimChange{Claim: name, To: &c}
+		if old, ok := oldClaims[name]; ok {
+			change.From = &old
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Claim < changes[j].Claim
+	})
+
+	if len(newClaims) != 0 {
+		after.TrustVector = &ear.TrustVector{}
+		if err := remarshal(newClaims, after.TrustVector); err != nil {
+			return nil, fmt.Errorf("policy outcome: %w", err)
+		}
+	}
+
+	switch {
+	case !isMissing(o.Status):
+		if err := remarshal(o.Status, &after.Status); err != nil {
+			return nil, fmt.Errorf("policy outcome: status: %w", err)
+		}
+	case after.TrustVector != nil && len(changes) != 0:
+		after.Status = ear.TrustTierNone
+		for _, c := range after.TrustVector.Claims() {
+			if tier := c.Tier(); tier > after.Status {
+				after.Status = tier
+			}
+		}
+	}
+
+	if !isMissing(o.PolicyClaims) {
+		claims, ok := o.PolicyClaims.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(
+				"policy outcome: added claims must be an object, got %T",
+				o.PolicyClaims,
+			)
+		}
+		after.PolicyClaims = claims
+	}
+
+	return &Evaluation{Before: before, After: &after, Changes: changes}, nil
+}
+
+func isMissing(v interface{}) bool {
+	s, ok := v.(string)
+	return v == nil || (ok && s == "MISSING")
+}
+
+func toTrustClaim(v interface{}) (ear.TrustClaim, error) {
+	n, ok := v.(float64)
+	if !ok || n != float64(int64(n)) || n < -128 || n > 127 {
+		return 0, fmt.Errorf("invalid trust claim value %v", v)
+	}
+	return ear.TrustClaim(n), nil
+}
+
+// remarshal converts src into dst by way of their JSON encoding
+func remarshal(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
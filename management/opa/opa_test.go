@@ -0,0 +1,110 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/verification/ear"
+)
+
+var testOPARules = []byte(`package policy
+
+executables = APPROVED_RUNTIME {
+	input.evidence["sw-version"] == "1.2.3"
+} else = UNRECOGNIZED_RUNTIME
+
+added_claims = {"checked-by": "test"}
+`)
+
+func testDraftAppraisal() *ear.Appraisal {
+	affirming := ear.TrustClaim(2)
+	return &ear.Appraisal{
+		Status: ear.TrustTierAffirming,
+		TrustVector: &ear.TrustVector{
+			InstanceIdentity: &affirming,
+			Executables:      &affirming,
+		},
+	}
+}
+
+func TestValidate_ok(t *testing.T) {
+	assert.NoError(t, Validate(testOPARules))
+}
+
+func TestValidate_syntax_error(t *testing.T) {
+	err := Validate([]byte("package policy\n\nexecutables = {\n"))
+	assert.ErrorContains(t, err, "parsing policy")
+}
+
+func TestValidate_wrong_package(t *testing.T) {
+	err := Validate([]byte("package other\n\nexecutables = 2\n"))
+	assert.EqualError(t, err, `policy package must be "policy", got "other"`)
+}
+
+func TestValidate_undefined_reference(t *testing.T) {
+	err := Validate([]byte("package policy\n\nexecutables = NO_SUCH_CLAIM\n"))
+	assert.ErrorContains(t, err, "compiling policy")
+	assert.ErrorContains(t, err, "NO_SUCH_CLAIM")
+}
+
+func TestEvaluate_unchanged(t *testing.T) {
+	res, err := Evaluate(context.Background(), testOPARules, Input{
+		Scheme:   "PSA_IOT",
+		Evidence: map[string]interface{}{"sw-version": "1.2.3"},
+		Result:   testDraftAppraisal(),
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, res.Changes)
+	assert.False(t, res.StatusChanged())
+	assert.Equal(t, ear.TrustTierAffirming, res.After.Status)
+	assert.Equal(t, map[string]interface{}{"checked-by": "test"}, res.After.PolicyClaims)
+}
+
+func TestEvaluate_changed(t *testing.T) {
+	policy, err := Compile(testOPARules)
+	require.NoError(t, err)
+
+	draft := testDraftAppraisal()
+
+	res, err := policy.Evaluate(context.Background(), Input{
+		Scheme:   "PSA_IOT",
+		Evidence: map[string]interface{}{"sw-version": "0.0.1"},
+		Result:   draft,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, res.Changes, 1)
+	assert.Equal(t, "executables", res.Changes[0].Claim)
+	assert.Equal(t, ear.TrustClaim(2), *res.Changes[0].From)
+	assert.Equal(t, ear.TrustClaim(33), *res.Changes[0].To)
+
+	assert.True(t, res.StatusChanged())
+	assert.Equal(t, ear.TrustTierWarning, res.After.Status)
+	assert.Equal(t, ear.TrustClaim(2), *res.After.TrustVector.InstanceIdentity)
+
+	// the draft appraisal is left untouched
+	assert.Equal(t, ear.TrustTierAffirming, draft.Status)
+	assert.Equal(t, ear.TrustClaim(2), *draft.TrustVector.Executables)
+}
+
+func TestEvaluate_explicit_status(t *testing.T) {
+	rules := []byte("package policy\n\nstatus = \"contraindicated\"\n")
+
+	res, err := Evaluate(context.Background(), rules, Input{
+		Result: testDraftAppraisal(),
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, res.Changes)
+	assert.Equal(t, ear.TrustTierContraindicated, res.After.Status)
+}
+
+func TestEvaluate_invalid_claim(t *testing.T) {
+	rules := []byte("package policy\n\nhardware = \"genuine\"\n")
+
+	_, err := Evaluate(context.Background(), rules, Input{})
+	assert.EqualError(t, err, `policy outcome: "hardware": invalid trust claim value genuine`)
+}
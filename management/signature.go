@@ -0,0 +1,314 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/veraison/apiclient/internal/jws"
+)
+
+var (
+	// ErrMissingPolicySignature is returned by a Service that enforces
+	// policy signatures when asked to create or activate a policy without
+	// signatures
+	ErrMissingPolicySignature = errors.New("policy is not signed")
+
+	// ErrPolicySignature is returned (wrapped) when the signatures of a
+	// policy do not satisfy the PolicyVerifier
+	ErrPolicySignature = errors.New("policy signature verification failed")
+)
+
+// PolicyKey is a public key trusted to sign policies
+type PolicyKey struct {
+	// KeyID is matched against the "kid" header parameter of the
+	// signature. It defaults to PolicyKeyID(Public).
+	KeyID string
+
+	// Public is an *ecdsa.PublicKey (P-256 or P-384), an
+	// ed25519.PublicKey or an *rsa.PublicKey.
+	Public crypto.PublicKey
+}
+
+// PolicyKeyID returns the identifier used for pub in policy signatures, i.e.,
+// the base64url encoded SHA-256 digest of its DER-encoded
+// SubjectPublicKeyInfo.
+func PolicyKeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(der)
+
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+// LoadPolicySigningKey reads a PEM-encoded PKCS #8, SEC 1 (EC) or PKCS #1
+// (RSA) private key from the file at path.
+func LoadPolicySigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading policy signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	var key interface{}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q in %s", block.Type, path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key in %s: %w", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// LoadPolicyKeys reads the trusted policy signing keys from the file at path,
+// which contains one or more PEM-encoded SubjectPublicKeyInfo or X.509
+// certificates.
+func LoadPolicyKeys(path string) ([]PolicyKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading policy keys: %w", err)
+	}
+
+	var keys []PolicyKey
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var pub crypto.PublicKey
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key in %s: %w", path, err)
+		}
+
+		keys = append(keys, PolicyKey{Public: pub})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", path)
+	}
+
+	return keys, nil
+}
+
+// PolicyVerifier checks the detached signatures of policies against a set of
+// trust anchors.
+type PolicyVerifier struct {
+	// Keys are the trust anchors.
+	Keys []PolicyKey
+
+	// Threshold is the number of distinct Keys that must have signed a
+	// policy for it to be accepted. Values lower than 1 are taken to be 1.
+	// A threshold of 2 provides two-person review guarantees.
+	Threshold int
+}
+
+// policyStatement is the payload of a policy signature. It binds the rules to
+// the scheme and name of the policy, so that signed rules cannot be reused
+// under a different identity.
+type policyStatement struct {
+	Scheme string `json:"scheme"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Hash   string `json:"hash"`
+}
+
+func newPolicyStatement(scheme, name, typ string, rules []byte) policyStatement {
+	return policyStatement{Scheme: scheme, Name: name, Type: typ, Hash: PolicyHash(rules)}
+}
+
+func (o policyStatement) payload() string {
+	data, _ := json.Marshal(o) // cannot fail: all fields are strings
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// SignPolicy returns a detached JWS (RFC 7515, Appendix F) over the policy
+// with the specified scheme, name, type and rules, signed with key. The
+// algorithm is ES256, ES384, EdDSA or PS256 depending on the type of key.
+func SignPolicy(key crypto.Signer, scheme, name, typ string, rules []byte) (string, error) {
+	alg, err := jws.AlgorithmFor(key.Public())
+	if err != nil {
+		return "", err
+	}
+
+	kid, err := PolicyKeyID(key.Public())
+	if err != nil {
+		return "", err
+	}
+
+	hdr, err := json.Marshal(jwsHeader{Alg: alg, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+
+	protected := base64.RawURLEncoding.EncodeToString(hdr)
+	signingInput := protected + "." + newPolicyStatement(scheme, name, typ, rules).payload()
+
+	sig, err := jws.Sign(key, alg, signingInput)
+	if err != nil {
+		return "", fmt.Errorf("signing policy: %w", err)
+	}
+
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Sign adds a signature by key to the policy.
+func (o *BundledPolicy) Sign(key crypto.Signer) error {
+	sig, err := SignPolicy(key, o.Scheme, o.Name, o.Type, []byte(o.Rules))
+	if err != nil {
+		return err
+	}
+
+	o.Signatures = append(o.Signatures, sig)
+
+	return nil
+}
+
+// Sign adds a signature by key to each policy in the bundle.
+func (o *PolicyBundle) Sign(key crypto.Signer) error {
+	for _, p := range o.Policies {
+		if err := p.Sign(key); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	return nil
+}
+
+// Verify checks that the policy with the specified scheme, name, type and
+// rules has been signed by at least Threshold of the trust anchors. The
+// returned error wraps ErrMissingPolicySignature or ErrPolicySignature.
+func (o PolicyVerifier) Verify(scheme, name, typ string, rules []byte, signatures []string) error {
+	if len(signatures) == 0 {
+		return ErrMissingPolicySignature
+	}
+
+	threshold := o.Threshold
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	payload := newPolicyStatement(scheme, name, typ, rules).payload()
+	signers := map[int]bool{}
+
+	var lastErr error
+
+	for _, s := range signatures {
+		i, err := o.verifySignature(s, payload)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		signers[i] = true
+	}
+
+	if len(signers) >= threshold {
+		return nil
+	}
+
+	if lastErr != nil {
+		return fmt.Errorf(
+			"%w: %d of %d required signers: %v",
+			ErrPolicySignature, len(signers), threshold, lastErr,
+		)
+	}
+
+	return fmt.Errorf(
+		"%w: %d of %d required signers", ErrPolicySignature, len(signers), threshold,
+	)
+}
+
+// verifySignature returns the index of the key that verifies the detached
+// JWS sig over payload
+func (o PolicyVerifier) verifySignature(sig, payload string) (int, error) {
+	parts := strings.Split(sig, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return -1, errors.New("malformed detached JWS")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return -1, fmt.Errorf("malformed JWS header: %w", err)
+	}
+
+	var hdr jwsHeader
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return -1, fmt.Errorf("decoding JWS header: %w", err)
+	}
+
+	rawSig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return -1, fmt.Errorf("malformed JWS signature: %w", err)
+	}
+
+	signingInput := parts[0] + "." + payload
+
+	for i, k := range o.Keys {
+		kid := k.KeyID
+		if kid == "" {
+			if kid, err = PolicyKeyID(k.Public); err != nil {
+				continue
+			}
+		}
+
+		if hdr.Kid != "" && hdr.Kid != kid {
+			continue
+		}
+
+		if alg, err := jws.AlgorithmFor(k.Public); err != nil || alg != hdr.Alg {
+			continue
+		}
+
+		if ok, _ := jws.Verify(hdr.Alg, k.Public, signingInput, rawSig); ok {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("no trusted key verifies the signature (kid %q)", hdr.Kid)
+}
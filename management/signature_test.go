@@ -0,0 +1,275 @@
+package management
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSigners(t *testing.T) map[string]crypto.Signer {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return map[string]crypto.Signer{
+		"ES256": p256,
+		"ES384": p384,
+		"EdDSA": ed,
+		"PS256": rsaKey,
+	}
+}
+
+func TestSignPolicy_roundtrip(t *testing.T) {
+	rules := []byte("package policy\n")
+
+	for alg, key := range testSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			sig, err := SignPolicy(key, "psa", "default", "opa", rules)
+			require.NoError(t, err)
+
+			v := PolicyVerifier{Keys: []PolicyKey{{Public: key.Public()}}}
+
+			assert.NoError(t, v.Verify("psa", "default", "opa", rules, []string{sig}))
+
+			err = v.Verify("psa", "default", "opa", []byte("package evil\n"), []string{sig})
+			assert.ErrorIs(t, err, ErrPolicySignature)
+
+			err = v.Verify("cca", "default", "opa", rules, []string{sig})
+			assert.ErrorIs(t, err, ErrPolicySignature)
+		})
+	}
+}
+
+func TestPolicyVerifier_Verify_threshold(t *testing.T) {
+	signers := testSigners(t)
+	rules := []byte("package policy\n")
+
+	alice, err := SignPolicy(signers["ES256"], "psa", "default", "opa", rules)
+	require.NoError(t, err)
+
+	bob, err := SignPolicy(signers["EdDSA"], "psa", "default", "opa", rules)
+	require.NoError(t, err)
+
+	v := PolicyVerifier{
+		Keys: []PolicyKey{
+			{Public: signers["ES256"].Public()},
+			{Public: signers["EdDSA"].Public()},
+		},
+		Threshold: 2,
+	}
+
+	err = v.Verify("psa", "default", "opa", rules, nil)
+	assert.ErrorIs(t, err, ErrMissingPolicySignature)
+
+	err = v.Verify("psa", "default", "opa", rules, []string{alice, alice})
+	assert.ErrorIs(t, err, ErrPolicySignature)
+	assert.ErrorContains(t, err, "1 of 2 required signers")
+
+	assert.NoError(t, v.Verify("psa", "default", "opa", rules, []string{alice, bob}))
+
+	err = v.Verify("psa", "default", "opa", rules, []string{alice, "not.a.jws"})
+	assert.ErrorContains(t, err, "malformed detached JWS")
+}
+
+func TestLoadPolicyKeys(t *testing.T) {
+	key := testSigners(t)["ES256"]
+	dir := t.TempDir()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(keyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	der, err = x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	pubPath := filepath.Join(dir, "pub.pem")
+	require.NoError(t, os.WriteFile(pubPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	signer, err := LoadPolicySigningKey(keyPath)
+	require.NoError(t, err)
+
+	keys, err := LoadPolicyKeys(pubPath)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	sig, err := SignPolicy(signer, "psa", "default", "opa", []byte("rules\n"))
+	require.NoError(t, err)
+
+	v := PolicyVerifier{Keys: keys}
+	assert.NoError(t, v.Verify("psa", "default", "opa", []byte("rules\n"), []string{sig}))
+
+	_, err = LoadPolicyKeys(keyPath)
+	assert.EqualError(t, err, "no public keys found in "+keyPath)
+}
+
+func TestService_CreatePolicy_enforced(t *testing.T) {
+	key := testSigners(t)["EdDSA"]
+
+	store := newTestPolicyStore(t)
+	service, teardown := store.service()
+	defer teardown()
+
+	service.PolicyVerifier = &PolicyVerifier{Keys: []PolicyKey{{Public: key.Public()}}}
+
+	_, err := service.CreateOPAPolicy("psa", []byte("rules\n"), "default")
+	assert.ErrorIs(t, err, ErrMissingPolicySignature)
+	assert.Empty(t, store.requests)
+
+	sig, err := SignPolicy(key, "psa", "default", "opa", []byte("rules\n"))
+	require.NoError(t, err)
+
+	p, err := service.CreateSignedPolicy("psa", OPARulesMediaType, []byte("rules\n"), "default", []string{sig})
+	require.NoError(t, err)
+
+	err = service.ActivatePolicy("psa", p.UUID)
+	assert.ErrorIs(t, err, ErrMissingPolicySignature)
+
+	// the rules have been tampered with on the server
+	store.policies["psa"][0].Rules = "evil rules\n"
+
+	err = service.ActivateSignedPolicy("psa", p.UUID, []string{sig})
+	assert.ErrorIs(t, err, ErrPolicySignature)
+	assert.Equal(t, []string{"POST policy/psa"}, store.requests)
+}
+
+func TestService_ImportPolicies_signed(t *testing.T) {
+	alice := testSigners(t)["ES256"]
+	bob := testSigners(t)["ES384"]
+
+	staging := newTestPolicyStore(t)
+	staging.add("psa", "default", "psa rules\n", true)
+	staging.add("cca", "default", "cca rules\n", true)
+
+	stagingService, teardown := staging.service()
+	defer teardown()
+
+	bundle, err := stagingService.ExportPolicies("psa", "cca")
+	require.NoError(t, err)
+
+	require.NoError(t, bundle.Sign(alice))
+	require.NoError(t, bundle.Policies[0].Sign(bob))
+
+	production := newTestPolicyStore(t)
+	productionService, teardown := production.service()
+	defer teardown()
+
+	productionService.PolicyVerifier = &PolicyVerifier{
+		Keys:      []PolicyKey{{Public: alice.Public()}, {Public: bob.Public()}},
+		Threshold: 2,
+	}
+
+	results, err := productionService.ImportPolicies(bundle, true)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, ImportCreated, results[0].Outcome)
+	assert.True(t, results[0].Activated)
+
+	assert.Equal(t, ImportFailed, results[1].Outcome)
+	assert.ErrorIs(t, results[1].Err, ErrPolicySignature)
+	assert.Empty(t, production.policies["cca"])
+}
+
+func testEnforcingService(t *testing.T, key crypto.Signer) (*testPolicyStore, *Service, func()) {
+	store := newTestPolicyStore(t)
+	service, teardown := store.service()
+
+	service.PolicyVerifier = &PolicyVerifier{Keys: []PolicyKey{{Public: key.Public()}}}
+
+	return store, service, teardown
+}
+
+func TestService_UpdatePolicy_enforced(t *testing.T) {
+	key := testSigners(t)["ES256"]
+
+	store, service, teardown := testEnforcingService(t, key)
+	defer teardown()
+
+	old := store.add("psa", "default", "v1\n", true)
+
+	_, err := service.UpdateOPAPolicy("psa", []byte("v2\n"), "default", true)
+	assert.ErrorIs(t, err, ErrMissingPolicySignature)
+
+	sig, err := SignPolicy(key, "psa", "default", "opa", []byte("v2\n"))
+	require.NoError(t, err)
+
+	p, err := service.UpdateSignedPolicy(
+		"psa", OPARulesMediaType, []byte("v2\n"), "default", true, []string{sig},
+	)
+	require.NoError(t, err)
+	assert.True(t, p.Active)
+	assert.False(t, old.Active)
+}
+
+func TestService_Sync_enforced(t *testing.T) {
+	key := testSigners(t)["EdDSA"]
+
+	store, service, teardown := testEnforcingService(t, key)
+	defer teardown()
+
+	sig, err := SignPolicy(key, "psa", "default", "opa", []byte("package policy\n"))
+	require.NoError(t, err)
+
+	unsigned := writeTestPolicyDir(t, map[string]string{
+		"psa/default.rego": "package policy\n",
+	})
+
+	_, err = service.Sync(unsigned, false)
+	assert.ErrorIs(t, err, ErrMissingPolicySignature)
+	assert.Empty(t, store.requests)
+
+	signed := writeTestPolicyDir(t, map[string]string{
+		"psa/default.rego":     "package policy\n",
+		"psa/default.rego.jws": "\n" + sig + "\n",
+	})
+
+	plan, err := service.Sync(signed, false)
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 2)
+	assert.Equal(t, []string{sig}, plan.Changes[0].Signatures)
+	assert.True(t, plan.Changes[1].Policy.Active)
+}
+
+func TestService_RollbackPolicy_enforced(t *testing.T) {
+	key := testSigners(t)["PS256"]
+
+	store, service, teardown := testEnforcingService(t, key)
+	defer teardown()
+
+	first := store.add("psa", "default", "v1\n", false)
+	store.add("psa", "default", "v2\n", true)
+
+	_, err := service.RollbackPolicy("psa", "default")
+	assert.ErrorIs(t, err, ErrMissingPolicySignature)
+
+	sig, err := SignPolicy(key, "psa", "default", "opa", []byte("v1\n"))
+	require.NoError(t, err)
+
+	p, err := service.RollbackSignedPolicy("psa", "default", []string{sig})
+	require.NoError(t, err)
+	assert.Equal(t, first.UUID, p.UUID)
+	assert.True(t, first.Active)
+}
@@ -0,0 +1,441 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SyncPolicyExt is the extension of the policy files picked up by Sync
+	SyncPolicyExt = ".rego"
+
+	// SyncSignatureExt is appended to the name of a policy file to obtain
+	// the name of its optional signature file, which contains the detached
+	// signatures of the policy (see SignPolicy), one per line
+	SyncSignatureExt = ".jws"
+
+	// SyncActiveFile is the name of the file that, within a scheme
+	// directory containing more than one policy, names the policy that
+	// should be active
+	SyncActiveFile = "ACTIVE"
+)
+
+// SyncAction identifies the operation carried out by a SyncChange
+type SyncAction string
+
+const (
+	// SyncCreate creates a new version of a policy whose rules differ from
+	// those of the latest version known to the service
+	SyncCreate SyncAction = "create"
+
+	// SyncActivate activates the desired policy of a scheme
+	SyncActivate SyncAction = "activate"
+)
+
+// SyncChange is a single step of a SyncPlan
+type SyncChange struct {
+	// Action is the operation to carry out.
+	Action SyncAction
+
+	// Scheme is the attestation scheme the policy is associated with.
+	Scheme string
+
+	// Name is the name of the policy.
+	Name string
+
+	// Path is the file the rules of the policy have been read from.
+	Path string
+
+	// Rules are the desired rules of the policy.
+	Rules []byte
+
+	// Signatures are the detached signatures of the policy, as read from
+	// its signature file, if any.
+	Signatures []string
+
+	// PolicyID identifies the existing policy version to activate. It is
+	// nil for SyncActivate changes that follow the SyncCreate of the same
+	// policy, in which case the newly created version is activated.
+	PolicyID *uuid.UUID
+
+	// Current is the latest existing version of the policy (SyncCreate), or
+	// the currently active policy of the scheme (SyncActivate), if any.
+	Current *Policy
+
+	// Diff is a unified diff between the rules of Current and Rules
+	// (SyncCreate only).
+	Diff string
+
+	// Policy is the policy created or activated by the change. It is only
+	// set once the change has been applied.
+	Policy *Policy
+}
+
+func (o SyncChange) String() string {
+	switch o.Action {
+	case SyncCreate:
+		return fmt.Sprintf("create %s/%s from %s\n%s", o.Scheme, o.Name, o.Path, o.Diff)
+	case SyncActivate:
+		target := "new version"
+		if o.PolicyID != nil {
+			target = o.PolicyID.String()
+		}
+
+		current := "none"
+		if o.Current != nil {
+			current = fmt.Sprintf("%s (%s)", o.Current.Name, o.Current.UUID)
+		}
+
+		return fmt.Sprintf("activate %s/%s %s (currently active: %s)\n",
+			o.Scheme, o.Name, target, current)
+	default:
+		return fmt.Sprintf("%s %s/%s\n", o.Action, o.Scheme, o.Name)
+	}
+}
+
+// SyncPlan is the list of changes needed to bring the policies of the service
+// in line with the contents of a policy directory
+type SyncPlan struct {
+	Changes []*SyncChange
+}
+
+// IsEmpty returns true if the service is already in sync
+func (o SyncPlan) IsEmpty() bool {
+	return len(o.Changes) == 0
+}
+
+// String returns a human readable description of the plan, including the
+// diffs of the policies that are going to be created.
+func (o SyncPlan) String() string {
+	if o.IsEmpty() {
+		return "no changes\n"
+	}
+
+	var b strings.Builder
+
+	for _, c := range o.Changes {
+		b.WriteString(c.String())
+	}
+
+	return b.String()
+}
+
+// syncScheme are the desired policies of a scheme, as read from its directory
+type syncScheme struct {
+	name     string
+	policies []syncPolicy
+	active   string
+}
+
+type syncPolicy struct {
+	name       string
+	path       string
+	rules      []byte
+	signatures []string
+}
+
+// Sync brings the OPA policies of the service in line with the contents of
+// dir. Each sub-directory of dir is named after an attestation scheme and
+// contains the policies for that scheme as <name>.rego files. A new version
+// of a policy is created only if its rules differ from those of the latest
+// version known to the service. The desired policy of each scheme is then
+// activated: if a scheme has more than one policy, the name of the one to
+// activate must be in a file named ACTIVE in the scheme directory.
+//
+// The signatures of a policy, required if the Service has a PolicyVerifier,
+// are read from the <name>.rego.jws file next to it.
+//
+// If dryRun is true, the service is not modified. In either case, the
+// returned plan describes the changes that are (or would be) made.
+func (o *Service) Sync(dir string, dryRun bool) (*SyncPlan, error) {
+	return o.SyncContext(context.Background(), dir, dryRun)
+}
+
+// SyncContext is like Sync but binds the requests to the supplied context.
+func (o *Service) SyncContext(ctx context.Context, dir string, dryRun bool) (*SyncPlan, error) {
+	plan, err := o.PlanSyncContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return plan, nil
+	}
+
+	return plan, o.ApplySyncContext(ctx, plan)
+}
+
+// PlanSync computes the changes that Sync would make, without modifying the
+// service.
+func (o *Service) PlanSync(dir string) (*SyncPlan, error) {
+	return o.PlanSyncContext(context.Background(), dir)
+}
+
+// PlanSyncContext is like PlanSync but binds the requests to the supplied
+// context.
+func (o *Service) PlanSyncContext(ctx context.Context, dir string) (*SyncPlan, error) {
+	schemes, err := readSyncDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{}
+
+	for _, s := range schemes {
+		existing, err := o.GetPoliciesContext(ctx, s.name, "")
+		if err != nil {
+			return nil, fmt.Errorf("retrieving policies for scheme %q: %w", s.name, err)
+		}
+
+		changes := planScheme(s, existing)
+		plan.Changes = append(plan.Changes, changes...)
+	}
+
+	return plan, nil
+}
+
+// ApplySync carries out the changes in plan, in order, stopping at the first
+// failure. The Policy field of each applied change is set to the resulting
+// policy.
+func (o *Service) ApplySync(plan *SyncPlan) error {
+	return o.ApplySyncContext(context.Background(), plan)
+}
+
+// ApplySyncContext is like ApplySync but binds the requests to the supplied
+// context.
+func (o *Service) ApplySyncContext(ctx context.Context, plan *SyncPlan) error {
+	if plan == nil {
+		return errors.New("no plan supplied")
+	}
+
+	created := map[string]*Policy{}
+
+	for _, c := range plan.Changes {
+		key := c.Scheme + "/" + c.Name
+
+		switch c.Action {
+		case SyncCreate:
+			pol, err := o.CreateSignedPolicyContext(
+				ctx, c.Scheme, OPARulesMediaType, c.Rules, c.Name, c.Signatures,
+			)
+			if err != nil {
+				return fmt.Errorf("creating %s: %w", key, err)
+			}
+
+			created[key] = pol
+			c.Policy = pol
+		case SyncActivate:
+			var pol *Policy
+
+			if c.PolicyID != nil {
+				pol = &Policy{UUID: *c.PolicyID, Name: c.Name}
+			} else if pol = created[key]; pol == nil {
+				return fmt.Errorf("activating %s: no policy version to activate", key)
+			}
+
+			if err := o.ActivateSignedPolicyContext(ctx, c.Scheme, pol.UUID, c.Signatures); err != nil {
+				return fmt.Errorf("activating %s: %w", key, err)
+			}
+
+			pol.Active = true
+			c.Policy = pol
+		default:
+			return fmt.Errorf("unknown sync action %q", c.Action)
+		}
+	}
+
+	return nil
+}
+
+// planScheme compares the desired policies of a scheme with the existing ones
+func planScheme(s syncScheme, existing []*Policy) []*SyncChange {
+	var (
+		changes []*SyncChange
+		active  *Policy
+		latest  = map[string]*Policy{}
+	)
+
+	for _, p := range existing {
+		if p.Active {
+			active = p
+		}
+
+		if l, ok := latest[p.Name]; !ok || p.CTime.After(l.CTime) {
+			latest[p.Name] = p
+		}
+	}
+
+	var activation *SyncChange
+
+	for _, p := range s.policies {
+		current := latest[p.name]
+
+		var policyID *uuid.UUID
+
+		if current != nil && current.Rules == string(p.rules) {
+			policyID = &current.UUID
+		} else {
+			changes = append(changes, &SyncChange{
+				Action:     SyncCreate,
+				Scheme:     s.name,
+				Name:       p.name,
+				Path:       p.path,
+				Rules:      p.rules,
+				Signatures: p.signatures,
+				Current:    current,
+				Diff:       diffPolicyRules(current, p),
+			})
+		}
+
+		if p.name != s.active {
+			continue
+		}
+
+		if policyID != nil && active != nil && active.UUID == *policyID {
+			continue
+		}
+
+		activation = &SyncChange{
+			Action:     SyncActivate,
+			Scheme:     s.name,
+			Name:       p.name,
+			Path:       p.path,
+			Rules:      p.rules,
+			Signatures: p.signatures,
+			PolicyID:   policyID,
+			Current:    active,
+		}
+	}
+
+	if activation != nil {
+		changes = append(changes, activation)
+	}
+
+	return changes
+}
+
+func diffPolicyRules(current *Policy, desired syncPolicy) string {
+	diff, err := diffRules(policyRules(current), string(desired.rules), policyLabel(current), desired.path)
+	if err != nil {
+		return fmt.Sprintf("(diff unavailable: %v)\n", err)
+	}
+
+	return diff
+}
+
+// readSyncDir reads the desired policies from dir, sorted by scheme and name
+func readSyncDir(dir string) ([]syncScheme, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy directory: %w", err)
+	}
+
+	var schemes []syncScheme
+
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		s, err := readSyncScheme(filepath.Join(dir, e.Name()), e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if len(s.policies) > 0 {
+			schemes = append(schemes, *s)
+		}
+	}
+
+	return schemes, nil
+}
+
+func readSyncScheme(dir, scheme string) (*syncScheme, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+SyncPolicyExt))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	s := syncScheme{name: scheme}
+
+	for _, path := range paths {
+		rules, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading policy: %w", err)
+		}
+
+		signatures, err := readSyncSignatures(path + SyncSignatureExt)
+		if err != nil {
+			return nil, err
+		}
+
+		s.policies = append(s.policies, syncPolicy{
+			name:       strings.TrimSuffix(filepath.Base(path), SyncPolicyExt),
+			path:       path,
+			rules:      rules,
+			signatures: signatures,
+		})
+	}
+
+	switch len(s.policies) {
+	case 0:
+		return &s, nil
+	case 1:
+		s.active = s.policies[0].name
+		return &s, nil
+	}
+
+	active, err := os.ReadFile(filepath.Join(dir, SyncActiveFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf(
+				"scheme %q has %d policies but no %s file naming the one to activate",
+				scheme, len(s.policies), SyncActiveFile,
+			)
+		}
+		return nil, fmt.Errorf("reading active policy name: %w", err)
+	}
+
+	s.active = strings.TrimSpace(string(active))
+
+	for _, p := range s.policies {
+		if p.name == s.active {
+			return &s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("scheme %q: active policy %q not found", scheme, s.active)
+}
+
+// readSyncSignatures reads the signatures in path, if it exists
+func readSyncSignatures(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading policy signatures: %w", err)
+	}
+
+	var signatures []string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			signatures = append(signatures, line)
+		}
+	}
+
+	return signatures, nil
+}
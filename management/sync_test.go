@@ -0,0 +1,224 @@
+package management
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/common"
+)
+
+// testPolicyStore is a minimal in-memory implementation of the policy
+// management API
+type testPolicyStore struct {
+	t        *testing.T
+	policies map[string][]*Policy
+	requests []string
+}
+
+func newTestPolicyStore(t *testing.T) *testPolicyStore {
+	return &testPolicyStore{t: t, policies: map[string][]*Policy{}}
+}
+
+func (o *testPolicyStore) add(scheme, name, rules string, active bool) *Policy {
+	p := &Policy{
+		UUID:   uuid.New(),
+		CTime:  time.Now().Add(time.Duration(len(o.policies[scheme])) * time.Second),
+		Name:   name,
+		Type:   "opa",
+		Rules:  rules,
+		Active: active,
+	}
+	o.policies[scheme] = append(o.policies[scheme], p)
+	return p
+}
+
+func (o *testPolicyStore) service() (*Service, func()) {
+	client, teardown := common.NewTestingHTTPClient(o)
+	return &Service{EndPointURI: testEndpointURI, Client: client}, teardown
+}
+
+func (o *testPolicyStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := o.t
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, testEndpointURI.Path+"/"), "/")
+
+	if r.Method != http.MethodGet {
+		o.requests = append(o.requests, r.Method+" "+strings.Join(parts, "/"))
+	}
+
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "policies":
+		w.Header().Set("Content-Type", PoliciesMediaType)
+		w.WriteHeader(http.StatusOK)
+		require.NoError(t, json.NewEncoder(w).Encode(o.policies[parts[1]]))
+	case r.Method == http.MethodGet && len(parts) == 2:
+		for _, p := range o.policies[parts[1]] {
+			if p.Active {
+				w.Header().Set("Content-Type", PolicyMediaType)
+				w.WriteHeader(http.StatusOK)
+				require.NoError(t, json.NewEncoder(w).Encode(p))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet && len(parts) == 3:
+		for _, p := range o.policies[parts[1]] {
+			if p.UUID.String() == parts[2] {
+				w.Header().Set("Content-Type", PolicyMediaType)
+				w.WriteHeader(http.StatusOK)
+				require.NoError(t, json.NewEncoder(w).Encode(p))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPost && len(parts) == 2:
+		rules, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		p := o.add(parts[1], r.URL.Query().Get("name"), string(rules), false)
+
+		w.Header().Set("Content-Type", PolicyMediaType)
+		w.WriteHeader(http.StatusCreated)
+		require.NoError(t, json.NewEncoder(w).Encode(p))
+	case r.Method == http.MethodPost && len(parts) == 4 && parts[3] == "activate":
+		for _, p := range o.policies[parts[1]] {
+			p.Active = p.UUID.String() == parts[2]
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete && len(parts) == 3:
+		policies := o.policies[parts[1]]
+		for i, p := range policies {
+			if p.UUID.String() == parts[2] {
+				o.policies[parts[1]] = append(policies[:i:i], policies[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		require.Fail(t, "unexpected request", "%s %s", r.Method, r.URL.Path)
+	}
+}
+
+func writeTestPolicyDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	return dir
+}
+
+func TestService_Sync(t *testing.T) {
+	store := newTestPolicyStore(t)
+	unchanged := store.add("psa", "default", "package policy\n", true)
+	store.add("cca", "default", "old rules\n", false)
+	oldActive := store.add("cca", "legacy", "legacy rules\n", true)
+
+	service, teardown := store.service()
+	defer teardown()
+
+	dir := writeTestPolicyDir(t, map[string]string{
+		"psa/default.rego": "package policy\n",
+		"cca/default.rego": "new rules\n",
+		"cca/legacy.rego":  "legacy rules\n",
+		"cca/ACTIVE":       "default\n",
+		"tpm/main.rego":    "tpm rules\n",
+		"README.md":        "not a scheme",
+	})
+
+	plan, err := service.Sync(dir, true)
+	require.NoError(t, err)
+	assert.Empty(t, store.requests, "dry run must not modify the service")
+
+	require.Len(t, plan.Changes, 4)
+
+	assert.Equal(t, SyncCreate, plan.Changes[0].Action)
+	assert.Equal(t, "cca", plan.Changes[0].Scheme)
+	assert.Equal(t, "default", plan.Changes[0].Name)
+	assert.Contains(t, plan.Changes[0].Diff, "-old rules\n+new rules\n")
+
+	assert.Equal(t, SyncActivate, plan.Changes[1].Action)
+	assert.Equal(t, "default", plan.Changes[1].Name)
+	assert.Nil(t, plan.Changes[1].PolicyID)
+	assert.Equal(t, oldActive.UUID, plan.Changes[1].Current.UUID)
+
+	assert.Equal(t, SyncCreate, plan.Changes[2].Action)
+	assert.Equal(t, "tpm", plan.Changes[2].Scheme)
+	assert.Contains(t, plan.Changes[2].Diff, "--- /dev/null\n")
+	assert.Equal(t, SyncActivate, plan.Changes[3].Action)
+
+	assert.Contains(t, plan.String(), "activate cca/default new version (currently active: legacy")
+
+	plan, err = service.Sync(dir, false)
+	require.NoError(t, err)
+	assert.Len(t, plan.Changes, 4)
+	assert.Len(t, store.requests, 4)
+
+	for _, c := range plan.Changes {
+		require.NotNil(t, c.Policy)
+	}
+	assert.True(t, plan.Changes[1].Policy.Active)
+	assert.True(t, unchanged.Active)
+	assert.False(t, oldActive.Active)
+
+	// once applied, there is nothing left to do
+	plan, err = service.PlanSync(dir)
+	require.NoError(t, err)
+	assert.True(t, plan.IsEmpty())
+	assert.Equal(t, "no changes\n", plan.String())
+}
+
+func TestService_Sync_activate_existing(t *testing.T) {
+	store := newTestPolicyStore(t)
+	existing := store.add("psa", "default", "package policy\n", false)
+
+	service, teardown := store.service()
+	defer teardown()
+
+	dir := writeTestPolicyDir(t, map[string]string{
+		"psa/default.rego": "package policy\n",
+	})
+
+	plan, err := service.Sync(dir, false)
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 1)
+	assert.Equal(t, SyncActivate, plan.Changes[0].Action)
+	assert.Equal(t, existing.UUID, *plan.Changes[0].PolicyID)
+	assert.True(t, existing.Active)
+}
+
+func TestService_Sync_bad_dir(t *testing.T) {
+	service := Service{EndPointURI: testEndpointURI}
+
+	for _, tv := range []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			map[string]string{"psa/a.rego": "a", "psa/b.rego": "b"},
+			`scheme "psa" has 2 policies but no ACTIVE file naming the one to activate`,
+		},
+		{
+			map[string]string{"psa/a.rego": "a", "psa/b.rego": "b", "psa/ACTIVE": "c"},
+			`scheme "psa": active policy "c" not found`,
+		},
+	} {
+		_, err := service.Sync(writeTestPolicyDir(t, tv.files), true)
+		assert.EqualError(t, err, tv.err)
+	}
+
+	_, err := service.Sync(filepath.Join(t.TempDir(), "missing"), true)
+	assert.ErrorContains(t, err, "reading policy directory")
+}
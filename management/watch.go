@@ -0,0 +1,182 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/veraison/apiclient/common"
+)
+
+// DefaultWatchInterval is the delay between the polls made by
+// WatchActivePolicy, unless the Service has a WatchInterval.
+const DefaultWatchInterval = 30 * time.Second
+
+// ActivePolicyChange is sent by WatchActivePolicy when the active policy of a
+// scheme changes, or when the active policy cannot be retrieved.
+type ActivePolicyChange struct {
+	// Scheme is the watched attestation scheme.
+	Scheme string
+
+	// OldUUID identifies the previously active policy. It is nil if no
+	// policy was active.
+	OldUUID *uuid.UUID
+
+	// NewUUID identifies the newly active policy. It is nil if no policy
+	// is active anymore.
+	NewUUID *uuid.UUID
+
+	// Policy is the newly active policy, if any.
+	Policy *Policy
+
+	// Timestamp is the time the change was detected.
+	Timestamp time.Time
+
+	// Err is set if the poll failed. In that case, the other fields, but
+	// Scheme and Timestamp, are unset and the watch carries on.
+	Err error
+}
+
+// WatchActivePolicy polls the active policy of the specified scheme and sends
+// an ActivePolicyChange on the returned channel each time it changes. The
+// policy active when the call is made is the baseline for the first change;
+// an error is returned if it cannot be retrieved.
+//
+// Polls are made every WatchInterval using conditional requests if the
+// service supplies an ETag for the active policy. A change is reported when
+// the UUID of the active policy, or the hash of its rules, differs from the
+// previous poll. The channel is closed once ctx is done.
+func (o *Service) WatchActivePolicy(
+	ctx context.Context,
+	scheme string,
+) (<-chan ActivePolicyChange, error) {
+	w := activePolicyWatcher{service: o, scheme: scheme}
+
+	if _, err := w.poll(ctx); err != nil {
+		return nil, err
+	}
+
+	interval := o.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	ch := make(chan ActivePolicyChange)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			change, err := w.poll(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				change = &ActivePolicyChange{Scheme: scheme, Timestamp: time.Now(), Err: err}
+			}
+
+			if change == nil {
+				continue
+			}
+
+			select {
+			case ch <- *change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// activePolicyWatcher keeps track of the last known active policy of a scheme
+type activePolicyWatcher struct {
+	service *Service
+	scheme  string
+	etag    string
+	current *Policy
+}
+
+// poll retrieves the active policy, returning the change since the previous
+// poll, or nil if there was none
+func (o *activePolicyWatcher) poll(ctx context.Context) (*ActivePolicyChange, error) {
+	getURI, err := o.service.endpointURI(GetActivePolicyEndpoint, o.scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := o.service.Client.GetResourceIfNoneMatchContext(
+		ctx, PolicyMediaType, o.etag, getURI.String(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	var active *Policy
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusNotFound:
+		o.etag = ""
+	default:
+		if err := common.CheckResponse(res, http.StatusOK); err != nil {
+			return nil, err
+		}
+
+		if active, err = policyFromResponse(res); err != nil {
+			return nil, err
+		}
+
+		o.etag = res.Header.Get("ETag")
+	}
+
+	previous := o.current
+	o.current = active
+
+	if samePolicy(previous, active) {
+		return nil, nil
+	}
+
+	change := ActivePolicyChange{
+		Scheme:    o.scheme,
+		Policy:    active,
+		Timestamp: time.Now(),
+	}
+
+	if previous != nil {
+		change.OldUUID = &previous.UUID
+	}
+
+	if active != nil {
+		change.NewUUID = &active.UUID
+	}
+
+	return &change, nil
+}
+
+// samePolicy returns whether a and b are the same policy with the same rules,
+// so that rules replaced in place by the service are detected too
+func samePolicy(a, b *Policy) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.UUID == b.UUID && PolicyHash([]byte(a.Rules)) == PolicyHash([]byte(b.Rules))
+}
@@ -0,0 +1,166 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/common"
+)
+
+// testActivePolicyServer serves the active policy of a single scheme
+type testActivePolicyServer struct {
+	t           *testing.T
+	mu          sync.Mutex
+	active      *Policy
+	useETag     bool
+	notModified int
+}
+
+func (o *testActivePolicyServer) setActive(p *Policy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.active = p
+}
+
+func (o *testActivePolicyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.active == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if o.useETag {
+		etag := `"` + o.active.UUID.String() + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			o.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+	} else {
+		assert.Empty(o.t, r.Header.Get("If-None-Match"))
+	}
+
+	w.Header().Set("Content-Type", PolicyMediaType)
+	w.WriteHeader(http.StatusOK)
+	require.NoError(o.t, json.NewEncoder(w).Encode(o.active))
+}
+
+func testWatchActivePolicy(t *testing.T, useETag bool) {
+	first := &Policy{UUID: uuid.New(), Name: "first", Type: "opa", Active: true}
+	second := &Policy{UUID: uuid.New(), Name: "second", Type: "opa", Active: true}
+
+	srv := &testActivePolicyServer{t: t, active: first, useETag: useETag}
+
+	client, teardown := common.NewTestingHTTPClient(srv)
+	defer teardown()
+
+	service := Service{
+		EndPointURI:   testEndpointURI,
+		Client:        client,
+		WatchInterval: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := service.WatchActivePolicy(ctx, "psa")
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	srv.setActive(second)
+
+	change := <-ch
+	require.NoError(t, change.Err)
+	assert.Equal(t, "psa", change.Scheme)
+	assert.Equal(t, first.UUID, *change.OldUUID)
+	assert.Equal(t, second.UUID, *change.NewUUID)
+	assert.Equal(t, "second", change.Policy.Name)
+
+	srv.setActive(nil)
+
+	change = <-ch
+	require.NoError(t, change.Err)
+	assert.Equal(t, second.UUID, *change.OldUUID)
+	assert.Nil(t, change.NewUUID)
+	assert.Nil(t, change.Policy)
+
+	cancel()
+
+	for range ch {
+	}
+
+	if useETag {
+		srv.mu.Lock()
+		assert.NotZero(t, srv.notModified)
+		srv.mu.Unlock()
+	}
+}
+
+func TestService_WatchActivePolicy_etag(t *testing.T) {
+	testWatchActivePolicy(t, true)
+}
+
+func TestService_WatchActivePolicy_no_etag(t *testing.T) {
+	testWatchActivePolicy(t, false)
+}
+
+func TestService_WatchActivePolicy_initial_failure(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	client, teardown := common.NewTestingHTTPClient(http.HandlerFunc(h))
+	defer teardown()
+
+	service := Service{EndPointURI: testEndpointURI, Client: client}
+
+	_, err := service.WatchActivePolicy(context.Background(), "psa")
+	assert.EqualError(t, err, "500 Internal Server Error")
+}
+
+func TestService_WatchActivePolicy_rules_changed_in_place(t *testing.T) {
+	before := &Policy{UUID: uuid.New(), Name: "default", Type: "opa", Rules: "v1", Active: true}
+	after := *before
+	after.Rules = "v2"
+
+	srv := &testActivePolicyServer{t: t, active: before}
+
+	client, teardown := common.NewTestingHTTPClient(srv)
+	defer teardown()
+
+	service := Service{
+		EndPointURI:   testEndpointURI,
+		Client:        client,
+		WatchInterval: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := service.WatchActivePolicy(ctx, "psa")
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	srv.setActive(&after)
+
+	change := <-ch
+	require.NoError(t, change.Err)
+	assert.Equal(t, before.UUID, *change.OldUUID)
+	assert.Equal(t, before.UUID, *change.NewUUID)
+	assert.Equal(t, "v2", change.Policy.Rules)
+
+	cancel()
+
+	for range ch {
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/veraison/apiclient/common"
+)
+
+const (
+	DiscoveryMediaType = common.DiscoveryMediaType
+
+	// DiscoveryPath is the path, relative to the provisioning service base
+	// URL, of its well-known discovery document
+	DiscoveryPath = "/.well-known/veraison/provisioning"
+
+	// SubmitEndpoint is the name under which the "/submit" endpoint is
+	// advertised in ServiceInfo.APIEndpoints
+	SubmitEndpoint = "provisioningSubmit"
+
+	ServiceStateReady = common.ServiceStateReady
+)
+
+// ServiceInfo models the well-known discovery document of the provisioning
+// service
+type ServiceInfo = common.ServiceInfo
+
+// UnsupportedMediaTypeError is returned by Run when the CheckMediaType
+// pre-flight finds that the server does not accept the endorsement media type
+type UnsupportedMediaTypeError struct {
+	MediaType string
+	Supported []string
+}
+
+func (o *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf(
+		"unsupported endorsement media type %q, the server accepts: %s",
+		o.MediaType, quoteAll(o.Supported),
+	)
+}
+
+func quoteAll(ss []string) string {
+	if len(ss) == 0 {
+		return "(none)"
+	}
+
+	q := make([]string, 0, len(ss))
+	for _, s := range ss {
+		q = append(q, fmt.Sprintf("%q", s))
+	}
+
+	return strings.Join(q, ", ")
+}
+
+// GetServiceInfo fetches the discovery document of the provisioning service
+// at baseURI using the supplied client
+func GetServiceInfo(client *common.Client, baseURI string) (*ServiceInfo, error) {
+	return GetServiceInfoContext(context.Background(), client, baseURI)
+}
+
+// GetServiceInfoContext is like GetServiceInfo but binds the request to the
+// supplied context.
+func GetServiceInfoContext(
+	ctx context.Context,
+	client *common.Client,
+	baseURI string,
+) (*ServiceInfo, error) {
+	uri, err := common.ResolveReference(baseURI, DiscoveryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var info ServiceInfo
+
+	if err := common.GetServiceInfoContext(ctx, client, uri, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
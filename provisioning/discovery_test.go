@@ -0,0 +1,148 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package provisioning
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/common"
+)
+
+const (
+	testBaseURI      = "http://veraison.example"
+	testDiscoveryDoc = `{
+	"media-types": [
+		"application/corim-unsigned+cbor; profile=\"http://arm.com/psa/iot/1\"",
+		"application/corim+cbor"
+	],
+	"version": "commit-cb11fa0",
+	"service-state": "READY",
+	"api-endpoints": {
+		"provisioningSubmit": "/endorsement-provisioning/v1/submit"
+	}
+}`
+)
+
+// testDiscoveryHandler serves the discovery document and counts the
+// submissions it receives
+func testDiscoveryHandler(t *testing.T, doc string, submissions *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case DiscoveryPath:
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, DiscoveryMediaType, r.Header.Get("Accept"))
+
+			w.WriteHeader(http.StatusOK)
+			_, e := w.Write([]byte(doc))
+			require.Nil(t, e)
+		default:
+			*submissions++
+
+			w.Header().Set("Content-Type", sessionMediaType)
+			w.WriteHeader(http.StatusOK)
+			_, e := w.Write([]byte(`{"status": "success", "expiry": "2030-10-12T07:20:50.52Z"}`))
+			require.Nil(t, e)
+		}
+	})
+}
+
+func TestGetServiceInfo_ok(t *testing.T) {
+	var submissions int
+
+	client, teardown := common.NewTestingHTTPClient(testDiscoveryHandler(t, testDiscoveryDoc, &submissions))
+	defer teardown()
+
+	info, err := GetServiceInfo(client, testBaseURI)
+	require.NoError(t, err)
+
+	assert.True(t, info.IsReady())
+	assert.Equal(t, "commit-cb11fa0", info.Version)
+	assert.True(t, info.SupportsMediaType(`application/corim-unsigned+cbor;profile="http://arm.com/psa/iot/1"`))
+	assert.False(t, info.SupportsMediaType("application/corim-unsigned+cbor"))
+
+	uri, err := info.Endpoint(SubmitEndpoint, testBaseURI)
+	require.NoError(t, err)
+	assert.Equal(t, testSubmitURI, uri)
+
+	_, err = info.Endpoint("nonExistent", testBaseURI)
+	assert.EqualError(t, err, `endpoint "nonExistent" not advertised by the service`)
+
+	_, err = GetServiceInfo(nil, testBaseURI)
+	assert.EqualError(t, err, "no client supplied")
+}
+
+func TestSubmitConfig_Discover(t *testing.T) {
+	var submissions int
+
+	client, teardown := common.NewTestingHTTPClient(testDiscoveryHandler(t, testDiscoveryDoc, &submissions))
+	defer teardown()
+
+	cfg := SubmitConfig{Client: client}
+
+	_, err := cfg.Discover(testBaseURI)
+	require.NoError(t, err)
+	assert.Equal(t, testSubmitURI, cfg.SubmitURI)
+	assert.Len(t, cfg.SupportedMediaTypes, 2)
+
+	_, err = cfg.Discover("/relative")
+	assert.EqualError(t, err, "uri is not absolute")
+}
+
+func TestSubmitConfig_Discover_not_ready(t *testing.T) {
+	var submissions int
+
+	h := testDiscoveryHandler(t, `{"service-state": "STARTING"}`, &submissions)
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := SubmitConfig{Client: client}
+
+	_, err := cfg.Discover(testBaseURI)
+	assert.EqualError(t, err, `provisioning service is not ready (state: "STARTING")`)
+}
+
+func TestSubmitConfig_Run_check_media_type(t *testing.T) {
+	var submissions int
+
+	client, teardown := common.NewTestingHTTPClient(testDiscoveryHandler(t, testDiscoveryDoc, &submissions))
+	defer teardown()
+
+	cfg := SubmitConfig{
+		Client:    client,
+		SubmitURI: testSubmitURI,
+	}
+	cfg.SetCheckMediaType(true)
+
+	// the supported media types are fetched on demand
+	_, err := cfg.Run(testEndorsement, testEndorsementMediaType)
+	require.NoError(t, err)
+	assert.Equal(t, 1, submissions)
+
+	_, err = cfg.Run(testEndorsement, "application/json")
+	assert.EqualError(t, err, `unsupported endorsement media type "application/json", the server accepts: `+
+		`"application/corim-unsigned+cbor; profile=\"http://arm.com/psa/iot/1\"", "application/corim+cbor"`)
+	assert.Equal(t, 1, submissions)
+
+	var mtErr *UnsupportedMediaTypeError
+	require.True(t, errors.As(err, &mtErr))
+	assert.Equal(t, "application/json", mtErr.MediaType)
+
+	// media types set by Discover are used as they are
+	cfg.SupportedMediaTypes = []string{"application/json"}
+
+	_, err = cfg.Run(testEndorsement, "application/json")
+	require.NoError(t, err)
+	assert.Equal(t, 2, submissions)
+
+	// without the pre-flight, anything goes
+	cfg.SetCheckMediaType(false)
+
+	_, err = cfg.Run(testEndorsement, "application/octet-stream")
+	require.NoError(t, err)
+	assert.Equal(t, 3, submissions)
+}
@@ -17,6 +17,22 @@ endpoint:
 		SubmitURI:	"http://veraison.example/endorsement-provisioning/v1/submit",
 	}
 
+Alternatively, the /submit endpoint can be discovered from the base URL of
+the provisioning service, which fetches its /.well-known/veraison/provisioning
+document:
+
+	var cfg SubmitConfig
+
+	info, err := cfg.Discover("https://veraison.example:9443")
+
+Discover also records the endorsement media types accepted by the server. If
+CheckMediaType is set, Run rejects any other media type locally, without
+submitting the endorsement, returning an *UnsupportedMediaTypeError that lists
+the accepted ones (the discovery document is fetched by Run if Discover was
+not called):
+
+	cfg.SetCheckMediaType(true)
+
 The user can also supply a custom Client object, for example to appropriately
 configure the underlying TLS transport:
 
@@ -31,6 +47,10 @@ server instead of letting it expire:
 
 	cfg.DeleteSession = true
 
+If the server processes the submission asynchronously, the session resource is
+polled according to common.DefaultPollPolicy, unless a different one is set
+via SetPollPolicy.
+
 Then the Run method is invoked on the instantiated SubmitConfig object to
 trigger the protocol FSM, hiding any details about the synchronus / async nature
 of the underlying exchange.  The user must supply the byte buffer containing the
@@ -38,6 +58,11 @@ serialized endorsement, and the associated media type:
 
 	session, err := cfg.Run(corimBuf, "application/corim+cbor")
 
+RunContext can be used instead of Run to bind the exchange, including any wait
+between polls of the session resource, to a context.Context:
+
+	session, err := cfg.RunContext(ctx, corimBuf, "application/corim+cbor")
+
 On success, session contains the final submission status and err is nil.
 The session object provides details like status, expiry time, and other
 submission information that can be displayed to the user.
@@ -4,6 +4,7 @@
 package provisioning
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -29,25 +30,31 @@ type SubmitSession struct {
 
 // SubmitConfig holds the context of an endorsement submission API session
 type SubmitConfig struct {
-	CACerts       []string            // paths to CA certs to be used in addition to system certs for TLS connections
-	Client        *common.Client      // HTTP(s) client connection configuration
-	SubmitURI     string              // URI of the /submit endpoint
-	Auth          auth.IAuthenticator // when set, Auth supplies the Authorization header for requests
-	DeleteSession bool                // explicitly DELETE the session object after we are done
-	UseTLS        bool                // use TLS for server connections
-	IsInsecure    bool                // allow insecure server connections (only matters when UseTLS is true)
+	CACerts       []string                // paths to CA certs to be used in addition to system certs for TLS connections
+	Client        *common.Client          // HTTP(s) client connection configuration
+	SubmitURI     string                  // URI of the /submit endpoint
+	Auth          auth.IAuthenticator     // when set, Auth supplies the Authorization header for requests, unless Client has its own
+	DeleteSession bool                    // explicitly DELETE the session object after we are done
+	UseTLS        bool                    // use TLS for server connections
+	IsInsecure    bool                    // allow insecure server connections (only matters when UseTLS is true)
+	PollPolicy    *common.PollPolicy      // how to poll the session resource while processing (if nil, common.DefaultPollPolicy is used)
+	ClientCert    *auth.ClientCertificate // client certificate for mutual TLS (only matters when UseTLS is true)
+
+	PinnedKeys            []string                       // SPKI pins of the trusted server keys, replacing CA verification (only matters when UseTLS is true)
+	VerifyPeerCertificate auth.VerifyPeerCertificateFunc // additional checks on the server certificate (only matters when UseTLS is true)
+
+	CheckMediaType      bool     // reject endorsement media types not advertised by the server before submitting
+	SupportedMediaTypes []string // endorsement media types accepted by the server (set by Discover, or fetched by Run when CheckMediaType is true)
 }
 
-// SetClient sets the HTTP(s) client connection configuration
+// SetClient sets the HTTP(s) client connection configuration. The supplied
+// client is not modified: if it has its own IAuthenticator, that is used for
+// the requests, otherwise Auth is.
 func (cfg *SubmitConfig) SetClient(client *common.Client) error {
 	if client == nil {
 		return errors.New("no client supplied")
 	}
 
-	if cfg.Auth != nil {
-		client.Auth = cfg.Auth
-	}
-
 	cfg.Client = client
 	return nil
 }
@@ -71,12 +78,20 @@ func (cfg *SubmitConfig) SetDeleteSession(session bool) {
 	cfg.DeleteSession = session
 }
 
-// SetAuth sets the IAuthenticator that will be used
+// SetAuth sets the IAuthenticator that will be used, unless Client has its
+// own
 func (cfg *SubmitConfig) SetAuth(a auth.IAuthenticator) {
 	cfg.Auth = a
-	if cfg.Client != nil {
-		cfg.Client.Auth = cfg.Auth
+}
+
+// SetPollPolicy sets the PollPolicy used while waiting for the submission to
+// complete
+func (cfg *SubmitConfig) SetPollPolicy(p common.PollPolicy) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("invalid poll policy: %w", err)
 	}
+	cfg.PollPolicy = &p
+	return nil
 }
 
 // SetIsInsecure sets the IsInsecure parameter using the supplied val
@@ -89,11 +104,111 @@ func (cfg *SubmitConfig) SetCerts(paths []string) {
 	cfg.CACerts = paths
 }
 
+// SetClientCert sets the certificate presented to servers requiring mutual
+// TLS
+func (cfg *SubmitConfig) SetClientCert(cc *auth.ClientCertificate) error {
+	if cc == nil {
+		return errors.New("no client certificate supplied")
+	}
+	if err := cc.Validate(); err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	cfg.ClientCert = cc
+	return nil
+}
+
+// SetPinnedKeys sets the SPKI pins (see auth.SPKIPin) of the keys the server
+// is trusted with. When set, the system and CACerts pools are not used to
+// verify the server's certificate.
+func (cfg *SubmitConfig) SetPinnedKeys(pins []string) error {
+	if len(pins) == 0 {
+		return errors.New("no pinned keys supplied")
+	}
+	if _, err := auth.ParseSPKIPins(pins); err != nil {
+		return err
+	}
+	cfg.PinnedKeys = pins
+	return nil
+}
+
+// SetVerifyPeerCertificate sets a callback for additional checks on the
+// server's certificate, run after the standard (or pinned) verification
+func (cfg *SubmitConfig) SetVerifyPeerCertificate(f auth.VerifyPeerCertificateFunc) error {
+	if f == nil {
+		return errors.New("no verification callback supplied")
+	}
+	cfg.VerifyPeerCertificate = f
+	return nil
+}
+
+// SetCheckMediaType enables (or disables) the pre-flight check of the
+// endorsement media type against those advertised by the server
+func (cfg *SubmitConfig) SetCheckMediaType(val bool) {
+	cfg.CheckMediaType = val
+}
+
+// Discover configures the SubmitURI and the SupportedMediaTypes from the
+// discovery document of the provisioning service at baseURI (e.g.,
+// "https://veraison.example:9443"). The TLS and Auth settings of the config
+// are used to fetch the document, which is returned for further inspection.
+func (cfg *SubmitConfig) Discover(baseURI string) (*ServiceInfo, error) {
+	return cfg.DiscoverContext(context.Background(), baseURI)
+}
+
+// DiscoverContext is like Discover but binds the request to the supplied
+// context
+func (cfg *SubmitConfig) DiscoverContext(ctx context.Context, baseURI string) (*ServiceInfo, error) {
+	u, err := url.Parse(baseURI)
+	if err != nil {
+		return nil, fmt.Errorf("malformed URI: %w", err)
+	}
+	if !u.IsAbs() {
+		return nil, errors.New("uri is not absolute")
+	}
+	cfg.UseTLS = u.Scheme == "https"
+
+	if err := cfg.initClient(); err != nil {
+		return nil, err
+	}
+
+	info, err := GetServiceInfoContext(ctx, cfg.client(), baseURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsReady() {
+		return nil, fmt.Errorf("provisioning service is not ready (state: %q)", info.ServiceState)
+	}
+
+	uri, err := info.Endpoint(SubmitEndpoint, baseURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.SetSubmitURI(uri); err != nil {
+		return nil, err
+	}
+
+	cfg.SupportedMediaTypes = info.MediaTypes
+
+	return info, nil
+}
+
 // Run implements the endorsement submission API.  If the session does not
 // complete synchronously, this call will block until either the session state
-// moves out of the processing state, or the MaxAttempts*PollPeriod threshold is
-// hit. On success, returns the final SubmitSession with status information.
+// moves out of the processing state, or the configured PollPolicy is
+// exhausted. On success, returns the final SubmitSession with status information.
 func (cfg SubmitConfig) Run(endorsement []byte, mediaType string) (*SubmitSession, error) {
+	return cfg.RunContext(context.Background(), endorsement, mediaType)
+}
+
+// RunContext is like Run but binds every request, and any wait between polls,
+// to the supplied context.
+func (cfg SubmitConfig) RunContext(
+	ctx context.Context,
+	endorsement []byte,
+	mediaType string,
+) (*SubmitSession, error) {
 	if err := cfg.check(); err != nil {
 		return nil, err
 	}
@@ -103,8 +218,15 @@ func (cfg SubmitConfig) Run(endorsement []byte, mediaType string) (*SubmitSessio
 		return nil, err
 	}
 
+	if cfg.CheckMediaType {
+		if err := cfg.checkMediaType(ctx, mediaType); err != nil {
+			return nil, err
+		}
+	}
+
 	// POST endorsement to the /submit endpoint
-	res, err := cfg.Client.PostResource(
+	res, err := cfg.client().PostResourceContext(
+		ctx,
 		endorsement,
 		mediaType,
 		sessionMediaType,
@@ -114,8 +236,8 @@ func (cfg SubmitConfig) Run(endorsement []byte, mediaType string) (*SubmitSessio
 		return nil, fmt.Errorf("submit request failed: %w", err)
 	}
 
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("unexpected HTTP response code %d", res.StatusCode)
+	if err := common.CheckResponse(res, http.StatusOK, http.StatusCreated); err != nil {
+		return nil, err
 	}
 
 	// if 200 or 201, we have been returned the provisioning session resource in
@@ -151,11 +273,16 @@ func (cfg SubmitConfig) Run(endorsement []byte, mediaType string) (*SubmitSessio
 		return nil, fmt.Errorf("cannot determine URI for the session resource: %w", err)
 	}
 
-	session, err := cfg.pollForSubmissionCompletion(sessionURI)
+	session, err := cfg.pollForSubmissionCompletion(ctx, sessionURI, common.RetryAfter(res))
 
 	// if requested, explicitly call DELETE on the session resource
 	if cfg.DeleteSession {
-		if delErr := cfg.Client.DeleteResource(sessionURI); delErr != nil {
+		// the session must be released even if ctx is what made the
+		// submission fail
+		delCtx, cancel := context.WithTimeout(common.WithoutCancel(ctx), common.CleanupTimeout)
+		defer cancel()
+
+		if delErr := cfg.client().DeleteResourceContext(delCtx, sessionURI); delErr != nil {
 			log.Printf("DELETE %s failed: %v", sessionURI, delErr)
 		}
 	}
@@ -163,22 +290,55 @@ func (cfg SubmitConfig) Run(endorsement []byte, mediaType string) (*SubmitSessio
 	return session, err
 }
 
+// checkMediaType makes sure that the server accepts endorsements of the
+// supplied media type, fetching the discovery document if the supported media
+// types are not known yet
+func (cfg SubmitConfig) checkMediaType(ctx context.Context, mediaType string) error {
+	supported := cfg.SupportedMediaTypes
+
+	if len(supported) == 0 {
+		info, err := GetServiceInfoContext(ctx, cfg.client(), cfg.SubmitURI)
+		if err != nil {
+			return fmt.Errorf("media type pre-flight check: %w", err)
+		}
+		supported = info.MediaTypes
+	}
+
+	if !common.SupportsMediaType(supported, mediaType) {
+		return &UnsupportedMediaTypeError{MediaType: mediaType, Supported: supported}
+	}
+
+	return nil
+}
+
 // pollForSubmissionCompletion polls the supplied URI while the resource state
 // is "processing".  If the resource state is still "processing" when the
-// configured number of polls has been attempted, or the state of the resource
+// configured PollPolicy has been exhausted, or the state of the resource
 // transitions to "failed", or an unexpected HTTP status is encountered, an
-// error is returned. On success, returns the final SubmitSession.
-func (cfg SubmitConfig) pollForSubmissionCompletion(uri string) (*SubmitSession, error) {
-	client := &cfg.Client.HTTPClient
+// error is returned. On success, returns the final SubmitSession. retryAfter
+// is the delay requested by the server before the first poll (zero if none).
+func (cfg SubmitConfig) pollForSubmissionCompletion(
+	ctx context.Context,
+	uri string,
+	retryAfter time.Duration,
+) (*SubmitSession, error) {
+	poller := common.NewPoller(cfg.pollPolicy())
+
+	for {
+		if err := poller.Wait(ctx, retryAfter); err != nil {
+			if errors.Is(err, common.ErrPollExhausted) {
+				break
+			}
+			return nil, fmt.Errorf("polling interrupted: %w", err)
+		}
 
-	for attempt := 1; attempt < common.MaxAttempts; attempt++ {
-		res, err := client.Get(uri)
+		res, err := cfg.client().GetResourceContext(ctx, sessionMediaType, uri)
 		if err != nil {
 			return nil, fmt.Errorf("session resource fetch failed: %w", err)
 		}
 
-		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("session resource fetch returned an unexpected status: %s", res.Status)
+		if err := common.CheckResponse(res, http.StatusOK); err != nil {
+			return nil, fmt.Errorf("session resource fetch failed: %w", err)
 		}
 
 		j, err := sessionFromResponse(res)
@@ -196,7 +356,7 @@ func (cfg SubmitConfig) pollForSubmissionCompletion(uri string) (*SubmitSession,
 			}
 			return nil, errors.New(s)
 		case common.APIStatusProcessing:
-			time.Sleep(common.PollPeriod)
+			retryAfter = common.RetryAfter(res)
 		default:
 			return nil, fmt.Errorf("unexpected session state %q in 200 response", j.Status)
 		}
@@ -210,6 +370,12 @@ func (cfg SubmitConfig) check() error {
 		return errors.New("bad configuration: no API endpoint")
 	}
 
+	if cfg.PollPolicy != nil {
+		if err := cfg.PollPolicy.Validate(); err != nil {
+			return fmt.Errorf("bad configuration: invalid poll policy: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -234,24 +400,55 @@ func sessionFromResponse(res *http.Response) (*SubmitSession, error) {
 	return &j, nil
 }
 
+// pollPolicy returns the user-supplied PollPolicy, or the default one
+func (cfg SubmitConfig) pollPolicy() common.PollPolicy {
+	if cfg.PollPolicy != nil {
+		return *cfg.PollPolicy
+	}
+	return common.DefaultPollPolicy
+}
+
 func (cfg *SubmitConfig) initClient() error {
 	if cfg.Client != nil {
 		return nil // client already initialized
 	}
 
+	// Auth is supplied by client(), so that it can still be changed with
+	// SetAuth
 	if !cfg.UseTLS {
-		cfg.Client = common.NewClient(cfg.Auth)
-		return nil
-	}
-
-	if cfg.IsInsecure {
-		cfg.Client = common.NewInsecureTLSClient(cfg.Auth)
+		cfg.Client = common.NewClient(nil)
 		return nil
 	}
 
 	var err error
 
-	cfg.Client, err = common.NewTLSClient(cfg.Auth, cfg.CACerts)
+	cfg.Client, err = common.NewTLSClientWithOptions(nil, cfg.tlsOptions())
 
 	return err
 }
+
+// client returns the client to be used for requests, i.e., Client
+// authenticating with Auth unless Client has its own IAuthenticator. Client
+// itself is never modified.
+func (cfg SubmitConfig) client() *common.Client {
+	if cfg.Auth == nil || cfg.Client.Auth != nil {
+		return cfg.Client
+	}
+
+	c := *cfg.Client
+	c.Auth = cfg.Auth
+
+	return &c
+}
+
+// tlsOptions returns the TLS settings for connections to the server
+func (cfg SubmitConfig) tlsOptions() auth.TLSOptions {
+	return auth.TLSOptions{
+		CACerts:    cfg.CACerts,
+		ClientCert: cfg.ClientCert,
+		Insecure:   cfg.IsInsecure,
+
+		PinnedKeys:            cfg.PinnedKeys,
+		VerifyPeerCertificate: cfg.VerifyPeerCertificate,
+	}
+}
@@ -4,9 +4,13 @@
 package provisioning
 
 import (
+	"context"
+	"crypto/x509"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -45,6 +49,25 @@ func TestSubmitConfig_SetClient_ok(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSubmitConfig_client_auth(t *testing.T) {
+	own := &auth.NullAuthenticator{}
+	cfgAuth := &auth.BasicAuthenticator{Username: "user1", Password: "Passw0rd!"}
+
+	// the Auth of the configuration is used by a client without its own
+	client := common.NewClient(nil)
+	cfg := SubmitConfig{Auth: cfgAuth}
+	require.NoError(t, cfg.SetClient(client))
+	assert.Nil(t, client.Auth)
+	assert.Equal(t, cfgAuth, cfg.client().Auth)
+
+	// ... but the Auth of the client wins
+	client = common.NewClient(own)
+	require.NoError(t, cfg.SetClient(client))
+	cfg.SetAuth(cfgAuth)
+	assert.Equal(t, own, client.Auth)
+	assert.Equal(t, own, cfg.client().Auth)
+}
+
 func TestSubmitConfig_SetClient_nil_client(t *testing.T) {
 	tv := SubmitConfig{}
 	expectedErr := `no client supplied`
@@ -99,10 +122,11 @@ func TestSubmitConfig_Run_fail_404_response(t *testing.T) {
 		Client:    client,
 	}
 
-	expectedErr := `unexpected HTTP response code 404`
+	expectedErr := `404 Not Found`
 
 	session, err := cfg.Run(testEndorsement, testEndorsementMediaType)
 	assert.EqualError(t, err, expectedErr)
+	assert.ErrorIs(t, err, common.ErrNotFound)
 	assert.Nil(t, session)
 }
 
@@ -438,7 +462,7 @@ func testSubmitConfigPollForSubmissionCompletionNegative(
 		Client:    client,
 	}
 
-	session, err := cfg.pollForSubmissionCompletion(testSessionURI)
+	session, err := cfg.pollForSubmissionCompletion(context.Background(), testSessionURI, 0)
 	assert.EqualError(t, err, expectedErr)
 	assert.Nil(t, session)
 }
@@ -446,7 +470,7 @@ func testSubmitConfigPollForSubmissionCompletionNegative(
 func TestSubmitConfig_pollForSubmissionCompletion_fail_not_found(t *testing.T) {
 	sessionBody := ``
 	responseCode := http.StatusNotFound
-	expectedErr := `session resource fetch returned an unexpected status: 404 Not Found`
+	expectedErr := `session resource fetch failed: 404 Not Found`
 
 	testSubmitConfigPollForSubmissionCompletionNegative(
 		t, responseCode, []byte(sessionBody), expectedErr,
@@ -520,11 +544,254 @@ func TestSubmitConfig_setters(t *testing.T) {
 	a := &auth.NullAuthenticator{}
 	cfg.SetAuth(a)
 	assert.Equal(t, a, cfg.Auth)
-	assert.Equal(t, a, cfg.Client.Auth)
+	assert.Nil(t, cfg.Client.Auth)
+	assert.Equal(t, a, cfg.client().Auth)
 
 	cfg.SetIsInsecure(true)
 	assert.True(t, cfg.IsInsecure)
 
 	cfg.SetCerts(testCertPaths)
 	assert.EqualValues(t, testCertPaths, cfg.CACerts)
+
+	err := cfg.SetClientCert(nil)
+	assert.EqualError(t, err, "no client certificate supplied")
+
+	err = cfg.SetClientCert(&auth.ClientCertificate{CertFile: "/test/client.crt"})
+	assert.EqualError(t, err, "invalid client certificate: missing client key")
+
+	cc := &auth.ClientCertificate{CertFile: "/test/client.crt", KeyFile: "/test/client.key"}
+	require.NoError(t, cfg.SetClientCert(cc))
+	assert.Equal(t, cc, cfg.ClientCert)
+	assert.Equal(t, cc, cfg.tlsOptions().ClientCert)
+
+	err = cfg.SetPinnedKeys(nil)
+	assert.EqualError(t, err, "no pinned keys supplied")
+
+	err = cfg.SetPinnedKeys([]string{"sha256/AAAA"})
+	assert.ErrorContains(t, err, "invalid public key pin")
+
+	pins := []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}
+	require.NoError(t, cfg.SetPinnedKeys(pins))
+	assert.Equal(t, pins, cfg.tlsOptions().PinnedKeys)
+
+	err = cfg.SetVerifyPeerCertificate(nil)
+	assert.EqualError(t, err, "no verification callback supplied")
+
+	require.NoError(t, cfg.SetVerifyPeerCertificate(
+		func([][]byte, [][]*x509.Certificate) error { return nil },
+	))
+	assert.NotNil(t, cfg.tlsOptions().VerifyPeerCertificate)
+}
+
+func TestSubmitConfig_RunContext_cancelled_while_polling(t *testing.T) {
+	sessionBody := `
+{
+    "status": "processing",
+    "expiry": "2030-10-12T07:20:50.52Z"
+}`
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", sessionMediaType)
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set("Location", testSessionURI)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+		}
+		_, e := w.Write([]byte(sessionBody))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := SubmitConfig{
+		SubmitURI: testSubmitURI,
+		Client:    client,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	session, err := cfg.RunContext(ctx, testEndorsement, testEndorsementMediaType)
+	assert.EqualError(t, err, "polling interrupted: context deadline exceeded")
+	assert.Nil(t, session)
+	assert.Less(t, time.Since(start), common.PollPeriod)
+}
+
+func TestSubmitConfig_RunContext_cancelled_deletes_session(t *testing.T) {
+	var deleted int32
+
+	sessionBody := `
+{
+    "status": "processing",
+    "expiry": "2030-10-12T07:20:50.52Z"
+}`
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", sessionMediaType)
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set("Location", testSessionURI)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			atomic.AddInt32(&deleted, 1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, e := w.Write([]byte(sessionBody))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := SubmitConfig{
+		SubmitURI:     testSubmitURI,
+		Client:        client,
+		DeleteSession: true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	session, err := cfg.RunContext(ctx, testEndorsement, testEndorsementMediaType)
+	assert.EqualError(t, err, "polling interrupted: context deadline exceeded")
+	assert.Nil(t, session)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&deleted))
+}
+
+func TestSubmitConfig_RunContext_cancelled(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Fail(t, "unexpected request")
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := SubmitConfig{
+		SubmitURI: testSubmitURI,
+		Client:    client,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	session, err := cfg.RunContext(ctx, testEndorsement, testEndorsementMediaType)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, session)
+}
+
+func TestSubmitConfig_Run_async_poll_policy(t *testing.T) {
+	sessionBody := `
+{
+    "status": "processing",
+    "expiry": "2030-10-12T07:20:50.52Z"
+}`
+
+	var (
+		created time.Time
+		polls   []time.Time
+	)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", sessionMediaType)
+		switch r.Method {
+		case http.MethodPost:
+			created = time.Now()
+			w.Header().Set("Location", testSessionURI)
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			polls = append(polls, time.Now())
+			w.WriteHeader(http.StatusOK)
+		}
+		_, e := w.Write([]byte(sessionBody))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := SubmitConfig{
+		SubmitURI: testSubmitURI,
+		Client:    client,
+	}
+	require.NoError(t, cfg.SetPollPolicy(common.PollPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxAttempts:  3,
+	}))
+
+	expectedErr := `polling attempts exhausted, session resource state still not complete`
+
+	session, err := cfg.Run(testEndorsement, testEndorsementMediaType)
+	assert.EqualError(t, err, expectedErr)
+	assert.Nil(t, session)
+	require.Len(t, polls, 3)
+	assert.GreaterOrEqual(t, polls[0].Sub(created), time.Second)
+}
+
+func TestSubmitConfig_check_bad_poll_policy(t *testing.T) {
+	tv := SubmitConfig{
+		SubmitURI:  testSubmitURI,
+		PollPolicy: &common.PollPolicy{Jitter: 2, MaxAttempts: 1},
+	}
+
+	expectedErr := `bad configuration: invalid poll policy: jitter must be in [0, 1], got 2`
+
+	err := tv.check()
+	assert.EqualError(t, err, expectedErr)
+}
+
+func TestSubmitConfig_Run_async_auth_on_every_hop(t *testing.T) {
+	sessionBodies := []string{
+		`{ "status": "processing", "expiry": "2030-12-25T10:30:45.123Z" }`,
+		`{ "status": "success", "expiry": "2030-12-25T10:30:45.123Z" }`,
+	}
+
+	var methods []string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Basic dXNlcjE6UGFzc3cwcmQh", r.Header.Get("Authorization"))
+
+		methods = append(methods, r.Method)
+
+		w.Header().Set("Content-Type", sessionMediaType)
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set("Location", testSessionURI)
+			w.WriteHeader(http.StatusCreated)
+			_, e := w.Write([]byte(sessionBodies[0]))
+			require.Nil(t, e)
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_, e := w.Write([]byte(sessionBodies[1]))
+			require.Nil(t, e)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := SubmitConfig{
+		SubmitURI:     testSubmitURI,
+		Client:        client,
+		DeleteSession: true,
+		Auth: &auth.BasicAuthenticator{
+			Username: "user1",
+			Password: "Passw0rd!",
+		},
+	}
+
+	session, err := cfg.Run(testEndorsement, testEndorsementMediaType)
+	require.NoError(t, err)
+	assert.Equal(t, "success", session.Status)
+	assert.Equal(t, []string{"POST", "GET", "DELETE"}, methods)
+	assert.Nil(t, client.Auth)
 }
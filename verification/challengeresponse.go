@@ -4,6 +4,8 @@
 package verification
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -15,9 +17,25 @@ import (
 
 	"github.com/veraison/apiclient/auth"
 	"github.com/veraison/apiclient/common"
+	"github.com/veraison/apiclient/verification/ear"
 	"github.com/veraison/cmw"
 )
 
+const (
+	sessionMediaType = "application/vnd.veraison.challenge-response-session+json"
+)
+
+// DefaultMaxResultAge and DefaultClockSkew are the freshness bounds applied
+// to EARs when ChallengeResponseConfig does not specify any
+const (
+	DefaultMaxResultAge = 5 * time.Minute
+	DefaultClockSkew    = time.Minute
+)
+
+// ErrSessionNonceMismatch is returned if the session resource does not carry
+// the nonce requested by the client
+var ErrSessionNonceMismatch = errors.New("session nonce does not match the requested one")
+
 type CmwWrap int
 
 const (
@@ -39,17 +57,26 @@ var cmwInfoMap = map[CmwWrap]cmwInfo{
 // ChallengeResponseConfig holds the configuration for one or more
 // challenge-response exchanges
 type ChallengeResponseConfig struct {
-	Nonce           []byte              // an explicit nonce supplied by the user
-	CACerts         []string            // paths to CA certs to be used in addition to system certs for TLS connections
-	NonceSz         uint                // the size of a nonce to be provided by server
-	EvidenceBuilder EvidenceBuilder     // Evidence generation logics supplied by the user
-	NewSessionURI   string              // URI of the "/newSession" endpoint
-	Client          *common.Client      // HTTP(s) client connection configuration
-	Wrap            CmwWrap             // when set, wrap the supplied evidence as a Conceptual Message Wrapper(CMW)
-	Auth            auth.IAuthenticator // when set, Auth supplies the Authorization header for requests
-	DeleteSession   bool                // explicitly DELETE the session object after we are done
-	UseTLS          bool                // use TLS for server connections
-	IsInsecure      bool                // allow insecure server connections (only matters when UseTLS is true)
+	Nonce           []byte                  // an explicit nonce supplied by the user
+	CACerts         []string                // paths to CA certs to be used in addition to system certs for TLS connections
+	NonceSz         uint                    // the size of a nonce to be provided by server
+	EvidenceBuilder EvidenceBuilder         // Evidence generation logics supplied by the user
+	NewSessionURI   string                  // URI of the "/newSession" endpoint
+	Client          *common.Client          // HTTP(s) client connection configuration
+	Wrap            CmwWrap                 // when set, wrap the supplied evidence as a Conceptual Message Wrapper(CMW)
+	Auth            auth.IAuthenticator     // when set, Auth supplies the Authorization header for requests, unless Client has its own
+	DeleteSession   bool                    // explicitly DELETE the session object after we are done
+	UseTLS          bool                    // use TLS for server connections
+	IsInsecure      bool                    // allow insecure server connections (only matters when UseTLS is true)
+	PollPolicy      *common.PollPolicy      // how to poll the session resource while processing (if nil, common.DefaultPollPolicy is used)
+	ClientCert      *auth.ClientCertificate // client certificate for mutual TLS (only matters when UseTLS is true)
+	EARKeys         []ear.Key               // keys for verifying the signature of the EAR returned by RunEAR (if empty, the signature is not checked)
+	SkipFreshness   bool                    // disable the nonce binding and freshness checks on sessions, and on the results returned by RunEAR
+	MaxResultAge    time.Duration           // maximum age of the EAR returned by RunEAR (if zero, DefaultMaxResultAge is used)
+	ClockSkew       time.Duration           // tolerated clock skew when checking the EAR issuance time (if zero, DefaultClockSkew is used)
+
+	PinnedKeys            []string                       // SPKI pins of the trusted server keys, replacing CA verification (only matters when UseTLS is true)
+	VerifyPeerCertificate auth.VerifyPeerCertificateFunc // additional checks on the server certificate (only matters when UseTLS is true)
 }
 
 // Blob wraps a base64 encoded value together with its media type
@@ -121,15 +148,117 @@ func (cfg *ChallengeResponseConfig) SetCerts(paths []string) {
 	cfg.CACerts = paths
 }
 
-// SetClient sets the HTTP(s) client connection configuration
+// SetClientCert sets the certificate presented to servers requiring mutual
+// TLS
+func (cfg *ChallengeResponseConfig) SetClientCert(cc *auth.ClientCertificate) error {
+	if cc == nil {
+		return errors.New("no client certificate supplied")
+	}
+	if err := cc.Validate(); err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	cfg.ClientCert = cc
+	return nil
+}
+
+// SetEARKeys sets the keys used by RunEAR to verify the signature of the
+// Attestation Result
+func (cfg *ChallengeResponseConfig) SetEARKeys(keys []ear.Key) error {
+	if len(keys) == 0 {
+		return errors.New("no EAR verification keys supplied")
+	}
+	cfg.EARKeys = keys
+	return nil
+}
+
+// SetEARKeysFile loads the keys used by RunEAR to verify the signature of the
+// Attestation Result from a JWK, JWKS or PEM public key file
+func (cfg *ChallengeResponseConfig) SetEARKeysFile(path string) error {
+	keys, err := ear.LoadKeys(path)
+	if err != nil {
+		return err
+	}
+	cfg.EARKeys = keys
+	return nil
+}
+
+// SetSkipFreshness disables (or re-enables) the checks binding sessions and
+// results to the requested nonce, and the freshness checks on EARs. The
+// checks on results are only done by RunEAR.
+func (cfg *ChallengeResponseConfig) SetSkipFreshness(val bool) {
+	cfg.SkipFreshness = val
+}
+
+// SetMaxResultAge sets the maximum age of the EAR returned by RunEAR
+func (cfg *ChallengeResponseConfig) SetMaxResultAge(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("the maximum result age must be positive")
+	}
+	cfg.MaxResultAge = d
+	return nil
+}
+
+// SetClockSkew sets the tolerated clock skew between client and verifier
+func (cfg *ChallengeResponseConfig) SetClockSkew(d time.Duration) error {
+	if d < 0 {
+		return errors.New("the clock skew must not be negative")
+	}
+	cfg.ClockSkew = d
+	return nil
+}
+
+// SetPinnedKeys sets the SPKI pins (see auth.SPKIPin) of the keys the server
+// is trusted with. When set, the system and CACerts pools are not used to
+// verify the server's certificate.
+func (cfg *ChallengeResponseConfig) SetPinnedKeys(pins []string) error {
+	if len(pins) == 0 {
+		return errors.New("no pinned keys supplied")
+	}
+	if _, err := auth.ParseSPKIPins(pins); err != nil {
+		return err
+	}
+	cfg.PinnedKeys = pins
+	return nil
+}
+
+// SetVerifyPeerCertificate sets a callback for additional checks on the
+// server's certificate, run after the standard (or pinned) verification
+func (cfg *ChallengeResponseConfig) SetVerifyPeerCertificate(f auth.VerifyPeerCertificateFunc) error {
+	if f == nil {
+		return errors.New("no verification callback supplied")
+	}
+	cfg.VerifyPeerCertificate = f
+	return nil
+}
+
+// SetClient sets the HTTP(s) client connection configuration. The supplied
+// client is not modified: if it has its own IAuthenticator, that is used for
+// the requests, otherwise Auth is.
 func (cfg *ChallengeResponseConfig) SetClient(client *common.Client) error {
 	if client == nil {
 		return errors.New("no client supplied")
 	}
+
 	cfg.Client = client
 	return nil
 }
 
+// SetAuth sets the IAuthenticator that will be used, unless Client has its
+// own
+func (cfg *ChallengeResponseConfig) SetAuth(a auth.IAuthenticator) {
+	cfg.Auth = a
+}
+
+// SetPollPolicy sets the PollPolicy used while waiting for the Attestation
+// Result
+func (cfg *ChallengeResponseConfig) SetPollPolicy(p common.PollPolicy) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("invalid poll policy: %w", err)
+	}
+	cfg.PollPolicy = &p
+	return nil
+}
+
 // SetDeleteSession sets the DeleteSession parameter using the supplied val
 func (cfg *ChallengeResponseConfig) SetDeleteSession(val bool) {
 	cfg.DeleteSession = val
@@ -155,34 +284,203 @@ func (cfg *ChallengeResponseConfig) SetWrap(val CmwWrap) error {
 
 // Run implements the challenge-response protocol FSM invoking the user
 // callback. On success, the received Attestation Result is returned.
+//
+// The Attestation Result is returned as is: unless SkipFreshness is set, the
+// session is checked to carry the requested nonce, but the result itself is
+// not, since Run does not assume it to be an EAR. Use RunEAR to also check
+// that the result is bound to the session nonce and recent enough.
 func (cfg *ChallengeResponseConfig) Run() ([]byte, error) {
-	if err := cfg.check(true); err != nil {
+	return cfg.RunContext(context.Background())
+}
+
+// RunEAR is like Run but decodes the received Attestation Result as an EAR.
+// If EARKeys is set, the signature of the EAR is verified and an
+// *ear.VerificationError is returned if it does not match; otherwise, the
+// signature is not checked. Unless SkipFreshness is set, the EAR must carry
+// the session nonce and have been issued within MaxResultAge.
+func (cfg *ChallengeResponseConfig) RunEAR() (*ear.AttestationResult, error) {
+	return cfg.RunEARContext(context.Background())
+}
+
+// RunEARContext is like RunEAR but binds every request, and any wait between
+// polls, to the supplied context.
+func (cfg *ChallengeResponseConfig) RunEARContext(ctx context.Context) (*ear.AttestationResult, error) {
+	result, nonce, err := cfg.run(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	// Attach the default client if the user hasn't supplied one
+	var ar *ear.AttestationResult
+
+	if len(cfg.EARKeys) == 0 {
+		ar, err = ear.Decode(result)
+	} else {
+		ar, err = ear.Verify(result, cfg.EARKeys)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SkipFreshness {
+		return ar, nil
+	}
+
+	if err := ar.CheckNonce(nonce); err != nil {
+		return nil, err
+	}
+
+	if err := ar.CheckFreshness(time.Now(), cfg.maxResultAge(), cfg.clockSkew()); err != nil {
+		return nil, err
+	}
+
+	return ar, nil
+}
+
+// maxResultAge returns the user-supplied MaxResultAge, or the default one
+func (cfg ChallengeResponseConfig) maxResultAge() time.Duration {
+	if cfg.MaxResultAge > 0 {
+		return cfg.MaxResultAge
+	}
+	return DefaultMaxResultAge
+}
+
+// clockSkew returns the user-supplied ClockSkew, or the default one
+func (cfg ChallengeResponseConfig) clockSkew() time.Duration {
+	if cfg.ClockSkew > 0 {
+		return cfg.ClockSkew
+	}
+	return DefaultClockSkew
+}
+
+// DiscoverEARKeys sets EARKeys to the EAR verification key advertised by the
+// verification service in its well-known discovery document
+func (cfg *ChallengeResponseConfig) DiscoverEARKeys() error {
+	return cfg.DiscoverEARKeysContext(context.Background())
+}
+
+// DiscoverEARKeysContext is like DiscoverEARKeys but binds the request to the
+// supplied context
+func (cfg *ChallengeResponseConfig) DiscoverEARKeysContext(ctx context.Context) error {
+	if cfg.NewSessionURI == "" {
+		return errors.New("bad configuration: the new session URI is required for discovery")
+	}
+
+	if err := cfg.initClient(); err != nil {
+		return err
+	}
+
+	info, err := GetServiceInfoContext(ctx, cfg.client(), cfg.NewSessionURI)
+	if err != nil {
+		return err
+	}
+
+	key, err := info.EARKey()
+	if err != nil {
+		return err
+	}
+
+	cfg.EARKeys = []ear.Key{*key}
+
+	return nil
+}
+
+// Discover configures the NewSessionURI, and the EARKeys if not already set,
+// from the discovery document of the verification service at baseURI (e.g.,
+// "https://veraison.example:8443"). The TLS and Auth settings of the config
+// are used to fetch the document, which is returned for further inspection
+// (e.g., of the supported Evidence media types).
+func (cfg *ChallengeResponseConfig) Discover(baseURI string) (*ServiceInfo, error) {
+	return cfg.DiscoverContext(context.Background(), baseURI)
+}
+
+// DiscoverContext is like Discover but binds the request to the supplied
+// context
+func (cfg *ChallengeResponseConfig) DiscoverContext(
+	ctx context.Context,
+	baseURI string,
+) (*ServiceInfo, error) {
+	u, err := url.Parse(baseURI)
+	if err != nil {
+		return nil, fmt.Errorf("malformed base URI: %w", err)
+	}
+	if !u.IsAbs() {
+		return nil, errors.New("the supplied base URI is not in absolute form")
+	}
+	cfg.UseTLS = u.Scheme == "https"
+
 	if err := cfg.initClient(); err != nil {
 		return nil, err
 	}
 
-	newSessionCtx, sessionURI, err := cfg.newSession()
+	info, err := GetServiceInfoContext(ctx, cfg.client(), baseURI)
 	if err != nil {
-		return nil, fmt.Errorf("new challenge-response session creation failed: %w", err)
+		return nil, err
+	}
+
+	if !info.IsReady() {
+		return nil, fmt.Errorf("verification service is not ready (state: %q)", info.ServiceState)
+	}
+
+	uri, err := info.Endpoint(NewChallengeResponseSessionEndpoint, baseURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.SetSessionURI(uri); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.EARKeys) == 0 && len(info.EARVerificationKey) > 0 {
+		key, err := info.EARKey()
+		if err != nil {
+			return nil, err
+		}
+		cfg.EARKeys = []ear.Key{*key}
+	}
+
+	return info, nil
+}
+
+// RunContext is like Run but binds every request, and any wait between polls,
+// to the supplied context. Like Run, it does not check the freshness of the
+// Attestation Result.
+func (cfg *ChallengeResponseConfig) RunContext(ctx context.Context) ([]byte, error) {
+	result, _, err := cfg.run(ctx)
+	return result, err
+}
+
+// run implements RunContext, additionally returning the session nonce
+func (cfg *ChallengeResponseConfig) run(ctx context.Context) ([]byte, []byte, error) {
+	if err := cfg.check(true); err != nil {
+		return nil, nil, err
+	}
+
+	// Attach the default client if the user hasn't supplied one
+	if err := cfg.initClient(); err != nil {
+		return nil, nil, err
+	}
+
+	newSessionCtx, sessionURI, err := cfg.newSession(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new challenge-response session creation failed: %w", err)
 	}
 
 	evidence, mediaType, err := cfg.EvidenceBuilder.BuildEvidence(newSessionCtx.Nonce, newSessionCtx.Accept)
 	if err != nil {
-		return nil, fmt.Errorf("evidence generation failed: %w", err)
+		return nil, nil, fmt.Errorf("evidence generation failed: %w", err)
 	}
 
 	if cfg.Wrap != NoWrap {
 		evidence, mediaType, err = cfg.wrapEvInCMW(evidence, mediaType)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	return cfg.ChallengeResponse(evidence, mediaType, sessionURI)
+	result, err := cfg.submitEvidence(ctx, evidence, mediaType, sessionURI, newSessionCtx.Nonce)
+
+	return result, newSessionCtx.Nonce, err
 }
 
 func (cfg ChallengeResponseConfig) wrapEvInCMW(evidence []byte, mt string) ([]byte, string, error) {
@@ -206,6 +504,14 @@ func (cfg ChallengeResponseConfig) wrapEvInCMW(evidence []byte, mt string) ([]by
 // creation, nonce and token format negotiation. On success, the session object
 // is returned together with the URI of the new session endpoint
 func (cfg ChallengeResponseConfig) NewSession() (*ChallengeResponseSession, string, error) {
+	return cfg.NewSessionContext(context.Background())
+}
+
+// NewSessionContext is like NewSession but binds the request to the supplied
+// context.
+func (cfg ChallengeResponseConfig) NewSessionContext(
+	ctx context.Context,
+) (*ChallengeResponseSession, string, error) {
 	if err := cfg.check(false); err != nil {
 		return nil, "", err
 	}
@@ -215,28 +521,60 @@ func (cfg ChallengeResponseConfig) NewSession() (*ChallengeResponseSession, stri
 		return nil, "", err
 	}
 
-	return cfg.newSession()
+	return cfg.newSession(ctx)
 }
 
 // ChallengeResponse runs the second portion of the interaction protocol that
 // deals with Evidence submission and retrieval of the associated Attestation
 // Result.  On success, the Attestation result in JSON format is returned.
+// Unless SkipFreshness is set, the session resource must carry the Nonce
+// configured by the user (if any). As with Run, the freshness of the returned
+// Attestation Result is not checked: decode it with ear.Decode (or ear.Verify)
+// and use its CheckNonce and CheckFreshness methods for that.
 func (cfg ChallengeResponseConfig) ChallengeResponse(
 	evidence []byte,
 	mediaType string,
 	uri string,
+) ([]byte, error) {
+	return cfg.ChallengeResponseContext(context.Background(), evidence, mediaType, uri)
+}
+
+// ChallengeResponseContext is like ChallengeResponse but binds every request,
+// and any wait between polls, to the supplied context.
+func (cfg ChallengeResponseConfig) ChallengeResponseContext(
+	ctx context.Context,
+	evidence []byte,
+	mediaType string,
+	uri string,
+) ([]byte, error) {
+	return cfg.submitEvidence(ctx, evidence, mediaType, uri, cfg.Nonce)
+}
+
+// submitEvidence implements ChallengeResponseContext, checking the session
+// resource against the supplied nonce (if any)
+func (cfg ChallengeResponseConfig) submitEvidence(
+	ctx context.Context,
+	evidence []byte,
+	mediaType string,
+	uri string,
+	nonce []byte,
 ) ([]byte, error) {
 	// At this point we must assume we have a Client
 	if cfg.Client == nil {
 		return nil, errors.New("bad configuration: nil client")
 	}
 
-	attestationResult, err := cfg.challengeResponse(evidence, mediaType, uri)
+	attestationResult, err := cfg.challengeResponse(ctx, evidence, mediaType, uri, nonce)
 
 	// if requested, explicitly call DELETE on the session resource
 
 	if cfg.DeleteSession {
-		if err2 := cfg.Client.DeleteResource(uri); err2 != nil {
+		// the session must be released even if ctx is what made the
+		// exchange fail
+		delCtx, cancel := context.WithTimeout(common.WithoutCancel(ctx), common.CleanupTimeout)
+		defer cancel()
+
+		if err2 := cfg.client().DeleteResourceContext(delCtx, uri); err2 != nil {
 			log.Printf("DELETE %s failed: %v", uri, err2)
 		}
 	}
@@ -244,16 +582,18 @@ func (cfg ChallengeResponseConfig) ChallengeResponse(
 	return attestationResult, err
 }
 
-func (cfg ChallengeResponseConfig) newSession() (*ChallengeResponseSession, string, error) {
-	res, err := cfg.newSessionRequest()
+func (cfg ChallengeResponseConfig) newSession(
+	ctx context.Context,
+) (*ChallengeResponseSession, string, error) {
+	res, err := cfg.newSessionRequest(ctx)
 	if err != nil {
 		return nil, "", fmt.Errorf("newSession request failed: %w", err)
 	}
 
 	// Expect 201 and a Location header containing the URI of the newly
 	// allocated session
-	if res.StatusCode != http.StatusCreated {
-		return nil, "", fmt.Errorf("newSession response has unexpected status: %s", res.Status)
+	if err := common.CheckResponse(res, http.StatusCreated); err != nil {
+		return nil, "", fmt.Errorf("newSession request failed: %w", err)
 	}
 
 	sessionURI, err := common.ExtractLocation(res, cfg.NewSessionURI)
@@ -269,37 +609,66 @@ func (cfg ChallengeResponseConfig) newSession() (*ChallengeResponseSession, stri
 		return nil, "", fmt.Errorf("failure JSON decoding response body: %w", err)
 	}
 
+	if err := cfg.checkNewSessionNonce(j.Nonce); err != nil {
+		return nil, "", err
+	}
+
 	return &j, sessionURI, nil
 }
 
-// newSessionRequest creates the POST request to the /newSession endpoint
-func (cfg ChallengeResponseConfig) newSessionRequest() (*http.Response, error) {
-	req, err := http.NewRequest("POST", cfg.NewSessionURI, http.NoBody)
+// checkNewSessionNonce makes sure that the nonce of a new session is the
+// one supplied by the user, or has the requested size
+func (cfg ChallengeResponseConfig) checkNewSessionNonce(nonce []byte) error {
+	if cfg.SkipFreshness {
+		return nil
+	}
+
+	if len(cfg.Nonce) > 0 {
+		return cfg.checkSessionNonce(nonce, cfg.Nonce)
+	}
+
+	if uint(len(nonce)) != cfg.NonceSz {
+		return fmt.Errorf(
+			"%w: expecting a %d bytes nonce, got %d",
+			ErrSessionNonceMismatch, cfg.NonceSz, len(nonce),
+		)
+	}
+
+	return nil
+}
+
+// checkSessionNonce makes sure that the session nonce matches the expected
+// one, if known
+func (cfg ChallengeResponseConfig) checkSessionNonce(nonce, expected []byte) error {
+	if cfg.SkipFreshness || len(expected) == 0 {
+		return nil
+	}
+
+	if !bytes.Equal(nonce, expected) {
+		return ErrSessionNonceMismatch
+	}
+
+	return nil
+}
+
+// newSessionRequest sends the POST request to the /newSession endpoint
+func (cfg ChallengeResponseConfig) newSessionRequest(ctx context.Context) (*http.Response, error) {
+	u, err := url.Parse(cfg.NewSessionURI)
 	if err != nil {
 		return nil, fmt.Errorf("building request for new session: %w", err)
 	}
 
 	// pass nonce-related info via query parameters (either nonce=3q2+7w== or
 	// nonceSize=32)
-	q := req.URL.Query()
+	q := u.Query()
 	if len(cfg.Nonce) > 0 {
 		q.Set("nonce", base64.URLEncoding.EncodeToString(cfg.Nonce))
 	} else if cfg.NonceSz > 0 {
 		q.Set("nonceSize", fmt.Sprint(cfg.NonceSz))
 	}
-	req.URL.RawQuery = q.Encode()
+	u.RawQuery = q.Encode()
 
-	// add the Accept header
-	req.Header.Set("Accept", "application/vnd.veraison.challenge-response-session+json")
-
-	hc := &cfg.Client.HTTPClient
-
-	res, err := hc.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("newSession request failed: %w", err)
-	}
-
-	return res, nil
+	return cfg.client().PostEmptyResourceContext(ctx, sessionMediaType, u.String())
 }
 
 // check makes sure that the config object is in good shape
@@ -326,6 +695,12 @@ func (cfg ChallengeResponseConfig) check(atomicRun bool) error {
 		}
 	}
 
+	if cfg.PollPolicy != nil {
+		if err := cfg.PollPolicy.Validate(); err != nil {
+			return fmt.Errorf("bad configuration: invalid poll policy: %w", err)
+		}
+	}
+
 	// It's OK if we don't have a client at this point in time; if needed we
 	// will instantiate the default one later.
 
@@ -333,15 +708,18 @@ func (cfg ChallengeResponseConfig) check(atomicRun bool) error {
 }
 
 func (cfg ChallengeResponseConfig) challengeResponse(
+	ctx context.Context,
 	evidence []byte,
 	mediaType string,
 	uri string,
+	nonce []byte,
 ) ([]byte, error) {
 	// build POST request with attestation evidence
-	res, err := cfg.Client.PostResource(
+	res, err := cfg.client().PostResourceContext(
+		ctx,
 		evidence,
 		mediaType,
-		"application/vnd.veraison.challenge-response-session+json",
+		sessionMediaType,
 		uri,
 	)
 	if err != nil {
@@ -358,6 +736,10 @@ func (cfg ChallengeResponseConfig) challengeResponse(
 			return nil, fmt.Errorf("failure decoding session resource body: %w", err)
 		}
 
+		if err := cfg.checkSessionNonce(j.Nonce, nonce); err != nil {
+			return nil, err
+		}
+
 		if j.Status != common.APIStatusComplete {
 			return nil, fmt.Errorf("unexpected session state: %s", j.Status)
 		}
@@ -365,29 +747,43 @@ func (cfg ChallengeResponseConfig) challengeResponse(
 		return j.Result, nil
 	case http.StatusAccepted:
 		// enter a poll loop until state is either complete or failed
-		return cfg.pollForAttestationResult(uri)
+		return cfg.pollForAttestationResult(ctx, uri, common.RetryAfter(res), nonce)
 	default:
 		// unexpected status code
-		return nil, fmt.Errorf("session response has unexpected status: %s", res.Status)
+		return nil, fmt.Errorf("session request failed: %w", common.CheckResponse(res))
 	}
 }
 
 // pollForAttestationResult polls the supplied URI until the resource state
 // transitions to "complete". If so, the attestation result is returned. If the
-// resource state is still "processing" when the configured number of polls has
-// been attempted, or the state of the resource transitions to "failed", an
-// error is returned.
-func (cfg ChallengeResponseConfig) pollForAttestationResult(uri string) ([]byte, error) {
-	client := &cfg.Client.HTTPClient
-
-	for attempt := 1; attempt < common.MaxAttempts; attempt++ {
-		res, err := client.Get(uri)
+// resource state is still "processing" when the configured PollPolicy has been
+// exhausted, or the state of the resource transitions to "failed", an error is
+// returned. retryAfter is the delay requested by the server before the first
+// poll (zero if none). If nonce is non-empty, the session resource must carry
+// it.
+func (cfg ChallengeResponseConfig) pollForAttestationResult(
+	ctx context.Context,
+	uri string,
+	retryAfter time.Duration,
+	nonce []byte,
+) ([]byte, error) {
+	poller := common.NewPoller(cfg.pollPolicy())
+
+	for {
+		if err := poller.Wait(ctx, retryAfter); err != nil {
+			if errors.Is(err, common.ErrPollExhausted) {
+				break
+			}
+			return nil, fmt.Errorf("polling interrupted: %w", err)
+		}
+
+		res, err := cfg.client().GetResourceContext(ctx, sessionMediaType, uri)
 		if err != nil {
 			return nil, fmt.Errorf("session resource fetch failed: %w", err)
 		}
 
-		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("session resource fetch returned an unexpected status: %s", res.Status)
+		if err := common.CheckResponse(res, http.StatusOK); err != nil {
+			return nil, fmt.Errorf("session resource fetch failed: %w", err)
 		}
 
 		j := ChallengeResponseSession{}
@@ -397,13 +793,17 @@ func (cfg ChallengeResponseConfig) pollForAttestationResult(uri string) ([]byte,
 			return nil, fmt.Errorf("failure decoding session resource: %w", err)
 		}
 
+		if err := cfg.checkSessionNonce(j.Nonce, nonce); err != nil {
+			return nil, err
+		}
+
 		switch j.Status {
 		case common.APIStatusComplete:
 			return j.Result, nil
 		case common.APIStatusFailed:
 			return nil, errors.New("session resource in failed state")
 		case common.APIStatusProcessing:
-			time.Sleep(common.PollPeriod)
+			retryAfter = common.RetryAfter(res)
 		default:
 			return nil, fmt.Errorf("session resource in unexpected state: %s", j.Status)
 		}
@@ -412,24 +812,55 @@ func (cfg ChallengeResponseConfig) pollForAttestationResult(uri string) ([]byte,
 	return nil, fmt.Errorf("polling attempts exhausted, session resource state still not complete")
 }
 
+// pollPolicy returns the user-supplied PollPolicy, or the default one
+func (cfg ChallengeResponseConfig) pollPolicy() common.PollPolicy {
+	if cfg.PollPolicy != nil {
+		return *cfg.PollPolicy
+	}
+	return common.DefaultPollPolicy
+}
+
 func (cfg *ChallengeResponseConfig) initClient() error {
 	if cfg.Client != nil {
 		return nil // client already initialized
 	}
 
+	// Auth is supplied by client(), so that it can still be changed with
+	// SetAuth
 	if !cfg.UseTLS {
-		cfg.Client = common.NewClient(cfg.Auth)
-		return nil
-	}
-
-	if cfg.IsInsecure {
-		cfg.Client = common.NewInsecureTLSClient(cfg.Auth)
+		cfg.Client = common.NewClient(nil)
 		return nil
 	}
 
 	var err error
 
-	cfg.Client, err = common.NewTLSClient(cfg.Auth, cfg.CACerts)
+	cfg.Client, err = common.NewTLSClientWithOptions(nil, cfg.tlsOptions())
 
 	return err
 }
+
+// client returns the client to be used for requests, i.e., Client
+// authenticating with Auth unless Client has its own IAuthenticator. Client
+// itself is never modified.
+func (cfg ChallengeResponseConfig) client() *common.Client {
+	if cfg.Auth == nil || cfg.Client.Auth != nil {
+		return cfg.Client
+	}
+
+	c := *cfg.Client
+	c.Auth = cfg.Auth
+
+	return &c
+}
+
+// tlsOptions returns the TLS settings for connections to the server
+func (cfg ChallengeResponseConfig) tlsOptions() auth.TLSOptions {
+	return auth.TLSOptions{
+		CACerts:    cfg.CACerts,
+		ClientCert: cfg.ClientCert,
+		Insecure:   cfg.IsInsecure,
+
+		PinnedKeys:            cfg.PinnedKeys,
+		VerifyPeerCertificate: cfg.VerifyPeerCertificate,
+	}
+}
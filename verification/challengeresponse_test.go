@@ -4,15 +4,25 @@
 package verification
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/auth"
 	"github.com/veraison/apiclient/common"
+	"github.com/veraison/apiclient/verification/ear"
 )
 
 var (
@@ -73,6 +83,25 @@ func TestChallengeResponseConfig_SetClient_ok(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestChallengeResponseConfig_client_auth(t *testing.T) {
+	own := &auth.NullAuthenticator{}
+	cfgAuth := &auth.BasicAuthenticator{Username: "user1", Password: "Passw0rd!"}
+
+	// the Auth of the configuration is used by a client without its own
+	client := common.NewClient(nil)
+	cfg := ChallengeResponseConfig{Auth: cfgAuth}
+	require.NoError(t, cfg.SetClient(client))
+	assert.Nil(t, client.Auth)
+	assert.Equal(t, cfgAuth, cfg.client().Auth)
+
+	// ... but the Auth of the client wins
+	client = common.NewClient(own)
+	require.NoError(t, cfg.SetClient(client))
+	cfg.SetAuth(cfgAuth)
+	assert.Equal(t, own, client.Auth)
+	assert.Equal(t, own, cfg.client().Auth)
+}
+
 func TestChallengeResponseConfig_SetClient_nil_client(t *testing.T) {
 	cfg := ChallengeResponseConfig{}
 	expectedErr := `no client supplied`
@@ -440,7 +469,7 @@ func TestChallengeResponseConfig_pollForAttestationResult_ok(t *testing.T) {
 
 	expectedResult := `{ "is_valid": true, "claims": {} }`
 
-	actualResult, err := cfg.pollForAttestationResult(sessionURI)
+	actualResult, err := cfg.pollForAttestationResult(context.Background(), sessionURI, 0, testNonce)
 
 	assert.Nil(t, err)
 	assert.JSONEq(t, expectedResult, string(actualResult))
@@ -478,7 +507,7 @@ func TestChallengeResponseConfig_pollForAttestationResult_failed_state(t *testin
 		Client: client,
 	}
 
-	_, err := cfg.pollForAttestationResult(sessionURI)
+	_, err := cfg.pollForAttestationResult(context.Background(), sessionURI, 0, testNonce)
 
 	assert.EqualError(t, err, "session resource in failed state")
 }
@@ -515,7 +544,7 @@ func TestChallengeResponseConfig_pollForAttestationResult_unexpected_state(t *te
 		Client: client,
 	}
 
-	_, err := cfg.pollForAttestationResult(sessionURI)
+	_, err := cfg.pollForAttestationResult(context.Background(), sessionURI, 0, testNonce)
 
 	assert.EqualError(t, err, "session resource in unexpected state: bonkers")
 }
@@ -550,9 +579,13 @@ func TestChallengeResponseConfig_pollForAttestationResult_exhaustion(t *testing.
 
 	cfg := ChallengeResponseConfig{
 		Client: client,
+		PollPolicy: &common.PollPolicy{
+			InitialDelay: 10 * time.Millisecond,
+			MaxAttempts:  2,
+		},
 	}
 
-	_, err := cfg.pollForAttestationResult(sessionURI)
+	_, err := cfg.pollForAttestationResult(context.Background(), sessionURI, 0, testNonce)
 
 	assert.EqualError(t, err, "polling attempts exhausted, session resource state still not complete")
 }
@@ -589,7 +622,7 @@ func TestChallengeResponseConfig_pollForAttestationResult_corrupted_resource(t *
 		Client: client,
 	}
 
-	_, err := cfg.pollForAttestationResult(sessionURI)
+	_, err := cfg.pollForAttestationResult(context.Background(), sessionURI, 0, testNonce)
 
 	assert.EqualError(t, err, "failure decoding session resource: unexpected EOF")
 }
@@ -928,9 +961,638 @@ func TestChallengeResponseConfig_setters(t *testing.T) {
 	cfg.SetDeleteSession(true)
 	assert.True(t, cfg.DeleteSession)
 
+	a := &auth.NullAuthenticator{}
+	cfg.SetAuth(a)
+	assert.Equal(t, a, cfg.Auth)
+	assert.Nil(t, cfg.Client.Auth)
+	assert.Equal(t, a, cfg.client().Auth)
+
 	cfg.SetIsInsecure(true)
 	assert.True(t, cfg.IsInsecure)
 
 	cfg.SetCerts(testCertPaths)
 	assert.EqualValues(t, testCertPaths, cfg.CACerts)
+
+	err := cfg.SetClientCert(nil)
+	assert.EqualError(t, err, "no client certificate supplied")
+
+	err = cfg.SetClientCert(&auth.ClientCertificate{CertFile: "/test/client.crt"})
+	assert.EqualError(t, err, "invalid client certificate: missing client key")
+
+	cc := &auth.ClientCertificate{CertFile: "/test/client.crt", KeyFile: "/test/client.key"}
+	require.NoError(t, cfg.SetClientCert(cc))
+	assert.Equal(t, cc, cfg.ClientCert)
+	assert.Equal(t, cc, cfg.tlsOptions().ClientCert)
+
+	err = cfg.SetPinnedKeys(nil)
+	assert.EqualError(t, err, "no pinned keys supplied")
+
+	err = cfg.SetPinnedKeys([]string{"sha256/AAAA"})
+	assert.ErrorContains(t, err, "invalid public key pin")
+
+	pins := []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}
+	require.NoError(t, cfg.SetPinnedKeys(pins))
+	assert.Equal(t, pins, cfg.tlsOptions().PinnedKeys)
+
+	err = cfg.SetVerifyPeerCertificate(nil)
+	assert.EqualError(t, err, "no verification callback supplied")
+
+	require.NoError(t, cfg.SetVerifyPeerCertificate(
+		func([][]byte, [][]*x509.Certificate) error { return nil },
+	))
+	assert.NotNil(t, cfg.tlsOptions().VerifyPeerCertificate)
+}
+
+func TestChallengeResponseConfig_RunContext_cancelled_while_polling(t *testing.T) {
+	sessionState := []string{`
+{
+    "nonce": "3q2+7w==",
+    "expiry": "2030-10-12T07:20:50.52Z",
+    "accept": [
+        "application/psa-attestation-token"
+    ],
+    "status": "waiting"
+}`, `
+{
+    "nonce": "3q2+7w==",
+    "expiry": "2030-10-12T07:20:50.52Z",
+    "accept": [
+        "application/psa-attestation-token"
+    ],
+    "status": "processing",
+	"evidence": {
+        "type": "application/psa-attestation-token",
+        "value": "ZXZpZGVuY2U="
+    }
+}`,
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/challenge-response/v1/newSession":
+			w.Header().Set("Location", testRelSessionURI)
+			w.WriteHeader(http.StatusCreated)
+			_, e := w.Write([]byte(sessionState[0]))
+			require.Nil(t, e)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusAccepted)
+			_, e := w.Write([]byte(sessionState[1]))
+			require.Nil(t, e)
+		default:
+			w.WriteHeader(http.StatusOK)
+			_, e := w.Write([]byte(sessionState[1]))
+			require.Nil(t, e)
+		}
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		Client:          client,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cfg.RunContext(ctx)
+	assert.EqualError(t, err, "polling interrupted: context deadline exceeded")
+	assert.Less(t, time.Since(start), common.PollPeriod)
+}
+
+func TestChallengeResponseConfig_RunContext_cancelled_deletes_session(t *testing.T) {
+	var deleted int32
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/challenge-response/v1/newSession":
+			w.Header().Set("Location", testRelSessionURI)
+			w.WriteHeader(http.StatusCreated)
+			_, e := w.Write([]byte(`{
+    "nonce": "3q2+7w==",
+    "expiry": "2030-10-12T07:20:50.52Z",
+    "accept": [ "application/psa-attestation-token" ],
+    "status": "waiting"
+}`))
+			require.Nil(t, e)
+		case r.Method == http.MethodDelete:
+			atomic.AddInt32(&deleted, 1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusAccepted)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+			_, e := w.Write([]byte(`{
+    "nonce": "3q2+7w==",
+    "expiry": "2030-10-12T07:20:50.52Z",
+    "accept": [ "application/psa-attestation-token" ],
+    "status": "processing"
+}`))
+			require.Nil(t, e)
+		}
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		Client:          client,
+		DeleteSession:   true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := cfg.RunContext(ctx)
+	assert.EqualError(t, err, "polling interrupted: context deadline exceeded")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&deleted))
+}
+
+func TestChallengeResponseConfig_NewSessionContext_cancelled(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Fail(t, "unexpected request")
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		Nonce:         testNonce,
+		NewSessionURI: testNewSessionURI,
+		Client:        client,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := cfg.NewSessionContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestChallengeResponseConfig_pollForAttestationResult_retry_after(t *testing.T) {
+	sessionState := []string{`
+{
+    "nonce": "3q2+7w==",
+    "status": "processing"
+}`, `
+{
+    "nonce": "3q2+7w==",
+    "status": "complete",
+	"result": {
+        "is_valid": true,
+		"claims": {}
+    }
+}`,
+	}
+
+	var polls []time.Time
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+
+		polls = append(polls, time.Now())
+
+		if len(polls) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusOK)
+			_, e := w.Write([]byte(sessionState[0]))
+			require.Nil(t, e)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, e := w.Write([]byte(sessionState[1]))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{Client: client}
+	require.NoError(t, cfg.SetPollPolicy(common.PollPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxAttempts:  5,
+	}))
+
+	expectedResult := `{ "is_valid": true, "claims": {} }`
+
+	actualResult, err := cfg.pollForAttestationResult(context.Background(), testSessionURI, 0, testNonce)
+	require.NoError(t, err)
+	assert.JSONEq(t, expectedResult, string(actualResult))
+	require.Len(t, polls, 2)
+	assert.GreaterOrEqual(t, polls[1].Sub(polls[0]), time.Second)
+}
+
+func TestChallengeResponseConfig_SetPollPolicy(t *testing.T) {
+	cfg := ChallengeResponseConfig{}
+
+	err := cfg.SetPollPolicy(common.PollPolicy{InitialDelay: time.Second})
+	assert.EqualError(t, err, "invalid poll policy: at least one of deadline or max attempts must be set")
+	assert.Nil(t, cfg.PollPolicy)
+
+	p := common.PollPolicy{InitialDelay: time.Second, MaxAttempts: 10}
+	require.NoError(t, cfg.SetPollPolicy(p))
+	assert.Equal(t, p, *cfg.PollPolicy)
+	assert.Equal(t, p, cfg.pollPolicy())
+
+	cfg.PollPolicy = nil
+	assert.Equal(t, common.DefaultPollPolicy, cfg.pollPolicy())
+}
+
+func TestChallengeResponseConfig_Run_async_auth_on_every_hop(t *testing.T) {
+	sessionState := []string{`
+{
+    "nonce": "3q2+7w==",
+    "accept": [
+        "application/psa-attestation-token"
+    ],
+    "status": "waiting"
+}`, `
+{
+    "nonce": "3q2+7w==",
+    "status": "processing"
+}`, `
+{
+    "nonce": "3q2+7w==",
+    "status": "complete",
+	"result": {
+        "is_valid": true,
+		"claims": {}
+    }
+}`,
+	}
+
+	var methods []string
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Basic dXNlcjE6UGFzc3cwcmQh", r.Header.Get("Authorization"))
+
+		methods = append(methods, r.Method)
+
+		switch len(methods) {
+		case 1:
+			assert.Equal(t, http.MethodPost, r.Method)
+			w.Header().Set("Location", testRelSessionURI)
+			w.WriteHeader(http.StatusCreated)
+			_, e := w.Write([]byte(sessionState[0]))
+			require.Nil(t, e)
+		case 2:
+			assert.Equal(t, http.MethodPost, r.Method)
+			w.WriteHeader(http.StatusAccepted)
+			_, e := w.Write([]byte(sessionState[1]))
+			require.Nil(t, e)
+		case 3:
+			assert.Equal(t, http.MethodGet, r.Method)
+			w.WriteHeader(http.StatusOK)
+			_, e := w.Write([]byte(sessionState[2]))
+			require.Nil(t, e)
+		case 4:
+			assert.Equal(t, http.MethodDelete, r.Method)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		DeleteSession:   true,
+		Auth: &auth.BasicAuthenticator{
+			Username: "user1",
+			Password: "Passw0rd!",
+		},
+	}
+	require.NoError(t, cfg.SetClient(client))
+
+	_, err := cfg.Run()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"POST", "POST", "GET", "DELETE"}, methods)
+	assert.Nil(t, client.Auth)
+}
+
+func testEARServer(t *testing.T, result string) *common.Client {
+	iter := 1
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		switch iter {
+		case 1:
+			w.Header().Set("Location", testRelSessionURI)
+			w.WriteHeader(http.StatusCreated)
+			_, e := w.Write([]byte(`{
+				"nonce": "3q2+7w==",
+				"expiry": "2030-10-12T07:20:50.52Z",
+				"accept": ["application/my-evidence-media-type"],
+				"status": "waiting"
+			}`))
+			require.Nil(t, e)
+		case 2:
+			w.WriteHeader(http.StatusOK)
+			_, e := fmt.Fprintf(w, `{
+				"nonce": "3q2+7w==",
+				"expiry": "2030-10-12T07:20:50.52Z",
+				"accept": ["application/my-evidence-media-type"],
+				"status": "complete",
+				"evidence": {"type": "application/my-evidence-media-type", "value": "Dg0O"},
+				"result": %s
+			}`, result)
+			require.Nil(t, e)
+		}
+
+		iter++
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	t.Cleanup(teardown)
+
+	return client
+}
+
+func makeTestEAR(iat int64, nonce string) string {
+	claims := fmt.Sprintf(`{
+		"eat_profile": "tag:github.com,2023:veraison/ear",
+		"iat": %d,
+		"eat_nonce": %q,
+		"submods": {"PSA_IOT": {"ear.status": "affirming"}}
+	}`, iat, nonce)
+
+	return "eyJhbGciOiJFUzI1NiJ9." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims)) +
+		".c2lnbmF0dXJl"
+}
+
+func TestChallengeResponseConfig_RunEAR_ok(t *testing.T) {
+	jwt := makeTestEAR(time.Now().Unix(), "3q2-7w")
+
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		Client:          testEARServer(t, `"`+jwt+`"`),
+	}
+
+	res, err := cfg.RunEAR()
+	require.NoError(t, err)
+	assert.Equal(t, "3q2-7w", res.Nonce)
+	assert.Equal(t, ear.TrustTierAffirming, res.Status())
+}
+
+func TestChallengeResponseConfig_RunEAR_not_an_EAR(t *testing.T) {
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		Client:          testEARServer(t, `{"is_valid": true}`),
+	}
+
+	_, err := cfg.RunEAR()
+	assert.EqualError(t, err, "malformed JWT: expecting 3 parts, got 1")
+}
+
+func signTestEAR(t *testing.T, key *ecdsa.PrivateKey, claims string) string {
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestChallengeResponseConfig_RunEAR_verified(t *testing.T) {
+	claims := `{
+		"eat_profile": "tag:github.com,2023:veraison/ear",
+		"iat": 1666091373,
+		"submods": {"PSA_IOT": {"ear.status": "affirming"}}
+	}`
+
+	verifierKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwt := signTestEAR(t, verifierKey, claims)
+
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		Client:          testEARServer(t, `"`+jwt+`"`),
+		SkipFreshness:   true,
+	}
+	require.NoError(t, cfg.SetEARKeys([]ear.Key{{Public: verifierKey.Public()}}))
+
+	res, err := cfg.RunEAR()
+	require.NoError(t, err)
+	assert.Equal(t, ear.TrustTierAffirming, res.Status())
+
+	cfg.Client = testEARServer(t, `"`+jwt+`"`)
+	require.NoError(t, cfg.SetEARKeys([]ear.Key{{Public: otherKey.Public()}}))
+
+	_, err = cfg.RunEAR()
+	var verr *ear.VerificationError
+	assert.ErrorAs(t, err, &verr)
+
+	assert.EqualError(t, cfg.SetEARKeys(nil), "no EAR verification keys supplied")
+}
+
+func TestChallengeResponseConfig_DiscoverEARKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwk := fmt.Sprintf(`{"kty":"EC","crv":"P-256","alg":"ES256","x":"%s","y":"%s"}`,
+		base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/.well-known/veraison/verification", r.URL.Path)
+		assert.Equal(t, "application/vnd.veraison.discovery+json", r.Header.Get("Accept"))
+
+		w.WriteHeader(http.StatusOK)
+		_, e := fmt.Fprintf(w, `{
+			"ear-verification-key": %s,
+			"media-types": ["application/eat-cwt; profile=http://arm.com/psa/2.0.0"],
+			"version": "commit-cb11fa0",
+			"service-state": "READY",
+			"api-endpoints": {
+				"newChallengeResponseSession": "/challenge-response/v1/newSession"
+			}
+		}`, jwk)
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		NewSessionURI: testNewSessionURI,
+		Client:        client,
+	}
+
+	require.NoError(t, cfg.DiscoverEARKeys())
+	require.Len(t, cfg.EARKeys, 1)
+	assert.Equal(t, "ES256", cfg.EARKeys[0].Algorithm)
+	assert.True(t, key.PublicKey.Equal(cfg.EARKeys[0].Public))
+
+	cfg = ChallengeResponseConfig{}
+	assert.EqualError(t, cfg.DiscoverEARKeys(),
+		"bad configuration: the new session URI is required for discovery")
+}
+
+func TestChallengeResponseConfig_DiscoverEARKeys_no_key(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, e := w.Write([]byte(`{"service-state": "READY"}`))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		NewSessionURI: testNewSessionURI,
+		Client:        client,
+	}
+
+	assert.EqualError(t, cfg.DiscoverEARKeys(), "no EAR verification key in discovery document")
+}
+
+func TestChallengeResponseConfig_RunEAR_freshness(t *testing.T) {
+	now := time.Now().Unix()
+
+	for _, tv := range []struct {
+		ear string
+		err error
+	}{
+		{makeTestEAR(now, "3q2-7w=="), nil},
+		{makeTestEAR(now, "3q2+7w=="), nil},
+		{makeTestEAR(now, "AAAAAA"), ear.ErrNonceMismatch},
+		{makeTestEAR(now-3600, "3q2-7w"), ear.ErrStaleResult},
+		{makeTestEAR(now+3600, "3q2-7w"), ear.ErrStaleResult},
+	} {
+		cfg := ChallengeResponseConfig{
+			Nonce:           testNonce,
+			NewSessionURI:   testNewSessionURI,
+			EvidenceBuilder: testEvidenceBuilder{},
+			Client:          testEARServer(t, `"`+tv.ear+`"`),
+		}
+
+		_, err := cfg.RunEAR()
+		if tv.err == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, tv.err)
+		}
+	}
+
+	// a longer maximum age accepts older results
+	cfg := ChallengeResponseConfig{
+		Nonce:           testNonce,
+		NewSessionURI:   testNewSessionURI,
+		EvidenceBuilder: testEvidenceBuilder{},
+		Client:          testEARServer(t, `"`+makeTestEAR(now-3600, "3q2-7w")+`"`),
+	}
+	require.NoError(t, cfg.SetMaxResultAge(2*time.Hour))
+
+	_, err := cfg.RunEAR()
+	assert.NoError(t, err)
+
+	// opting out disables the checks altogether
+	cfg.Client = testEARServer(t, `"`+makeTestEAR(now-3600, "AAAAAA")+`"`)
+	cfg.MaxResultAge = 0
+	cfg.SetSkipFreshness(true)
+
+	_, err = cfg.RunEAR()
+	assert.NoError(t, err)
+
+	assert.EqualError(t, cfg.SetMaxResultAge(0), "the maximum result age must be positive")
+	assert.EqualError(t, cfg.SetClockSkew(-time.Second), "the clock skew must not be negative")
+	require.NoError(t, cfg.SetClockSkew(0))
+	assert.Equal(t, DefaultClockSkew, cfg.clockSkew())
+}
+
+func TestChallengeResponseConfig_NewSession_nonce_mismatch(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", testRelSessionURI)
+		w.WriteHeader(http.StatusCreated)
+		_, e := w.Write([]byte(`{
+			"nonce": "AAAAAA==",
+			"expiry": "2030-10-12T07:20:50.52Z",
+			"accept": ["application/psa-attestation-token"],
+			"status": "waiting"
+		}`))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{
+		Nonce:         testNonce,
+		NewSessionURI: testNewSessionURI,
+		Client:        client,
+	}
+
+	_, _, err := cfg.NewSession()
+	assert.ErrorIs(t, err, ErrSessionNonceMismatch)
+
+	cfg = ChallengeResponseConfig{
+		NonceSz:       32,
+		NewSessionURI: testNewSessionURI,
+		Client:        client,
+	}
+
+	_, _, err = cfg.NewSession()
+	assert.EqualError(t, err, "session nonce does not match the requested one: expecting a 32 bytes nonce, got 4")
+
+	cfg.SetSkipFreshness(true)
+
+	_, _, err = cfg.NewSession()
+	assert.NoError(t, err)
+}
+
+func TestChallengeResponseConfig_pollForAttestationResult_nonce_mismatch(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, e := w.Write([]byte(`{
+			"nonce": "AAAAAA==",
+			"expiry": "2030-10-12T07:20:50.52Z",
+			"accept": ["application/psa-attestation-token"],
+			"status": "complete",
+			"result": {"is_valid": true}
+		}`))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	defer teardown()
+
+	cfg := ChallengeResponseConfig{Client: client}
+
+	_, err := cfg.pollForAttestationResult(context.Background(), testSessionURI, 0, testNonce)
+	assert.ErrorIs(t, err, ErrSessionNonceMismatch)
+
+	// the nonce is not checked if unknown
+	_, err = cfg.pollForAttestationResult(context.Background(), testSessionURI, 0, nil)
+	assert.NoError(t, err)
 }
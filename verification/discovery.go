@@ -0,0 +1,77 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/veraison/apiclient/common"
+	"github.com/veraison/apiclient/verification/ear"
+)
+
+const (
+	DiscoveryMediaType = common.DiscoveryMediaType
+
+	// DiscoveryPath is the path, relative to the verification service base
+	// URL, of its well-known discovery document
+	DiscoveryPath = "/.well-known/veraison/verification"
+
+	// NewChallengeResponseSessionEndpoint is the name under which the
+	// "/newSession" endpoint is advertised in ServiceInfo.APIEndpoints
+	NewChallengeResponseSessionEndpoint = "newChallengeResponseSession"
+
+	ServiceStateReady = common.ServiceStateReady
+)
+
+// ServiceInfo models the well-known discovery document of the verification
+// service
+type ServiceInfo struct {
+	common.ServiceInfo
+
+	EARVerificationKey json.RawMessage `json:"ear-verification-key,omitempty"`
+}
+
+// GetServiceInfo fetches the discovery document of the verification service
+// at baseURI using the supplied client
+func GetServiceInfo(client *common.Client, baseURI string) (*ServiceInfo, error) {
+	return GetServiceInfoContext(context.Background(), client, baseURI)
+}
+
+// GetServiceInfoContext is like GetServiceInfo but binds the request to the
+// supplied context.
+func GetServiceInfoContext(
+	ctx context.Context,
+	client *common.Client,
+	baseURI string,
+) (*ServiceInfo, error) {
+	uri, err := common.ResolveReference(baseURI, DiscoveryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var info ServiceInfo
+
+	if err := common.GetServiceInfoContext(ctx, client, uri, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// EARKey returns the EAR verification key advertised by the service
+func (o ServiceInfo) EARKey() (*ear.Key, error) {
+	if len(o.EARVerificationKey) == 0 {
+		return nil, errors.New("no EAR verification key in discovery document")
+	}
+
+	key, err := ear.ParseJWK(o.EARVerificationKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing EAR verification key: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package verification
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/apiclient/common"
+)
+
+const testDiscoveryDoc = `{
+	"ear-verification-key": {
+		"alg": "ES256",
+		"crv": "P-256",
+		"kty": "EC",
+		"x": "usWxHK2PmfnHKwXPS54m0kTcGJ90UiglWiGahtagnv8",
+		"y": "IBOL-C3BttVivg-lSreASjpkttcsz-1rb7btKLv8EX4"
+	},
+	"media-types": [
+		"application/eat-cwt; profile=\"http://arm.com/psa/2.0.0\"",
+		"application/psa-attestation-token"
+	],
+	"version": "commit-cb11fa0",
+	"service-state": "READY",
+	"api-endpoints": {
+		"newChallengeResponseSession": "/challenge-response/v1/newSession"
+	}
+}`
+
+func testDiscoveryClient(t *testing.T, status int, ct, body string) *common.Client {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, DiscoveryPath, r.URL.Path)
+		assert.Equal(t, DiscoveryMediaType, r.Header.Get("Accept"))
+
+		w.Header().Set("Content-Type", ct)
+		w.WriteHeader(status)
+		_, e := w.Write([]byte(body))
+		require.Nil(t, e)
+	})
+
+	client, teardown := common.NewTestingHTTPClient(h)
+	t.Cleanup(teardown)
+
+	return client
+}
+
+func TestGetServiceInfo_ok(t *testing.T) {
+	client := testDiscoveryClient(t, http.StatusOK, DiscoveryMediaType, testDiscoveryDoc)
+
+	info, err := GetServiceInfo(client, testBaseURI)
+	require.NoError(t, err)
+
+	assert.True(t, info.IsReady())
+	assert.Equal(t, "commit-cb11fa0", info.Version)
+	assert.True(t, info.SupportsMediaType("application/psa-attestation-token"))
+	assert.False(t, info.SupportsMediaType("application/pem-certificate-chain"))
+	assert.True(t, info.SupportsMediaType(`Application/EAT-CWT;profile="http://arm.com/psa/2.0.0"`))
+	assert.False(t, info.SupportsMediaType("application/eat-cwt"))
+
+	uri, err := info.Endpoint(NewChallengeResponseSessionEndpoint, testBaseURI)
+	require.NoError(t, err)
+	assert.Equal(t, testNewSessionURI, uri)
+
+	_, err = info.Endpoint("nonExistent", testBaseURI)
+	assert.EqualError(t, err, `endpoint "nonExistent" not advertised by the service`)
+
+	key, err := info.EARKey()
+	require.NoError(t, err)
+	assert.Equal(t, "ES256", key.Algorithm)
+}
+
+func TestGetServiceInfo_problem(t *testing.T) {
+	client := testDiscoveryClient(t, http.StatusServiceUnavailable, "application/problem+json",
+		`{"type": "about:blank", "title": "Service Unavailable", "status": 503, "detail": "down for maintenance"}`)
+
+	_, err := GetServiceInfo(client, testBaseURI)
+	assert.EqualError(t, err, "503 Service Unavailable: down for maintenance")
+
+	_, err = GetServiceInfo(nil, testBaseURI)
+	assert.EqualError(t, err, "no client supplied")
+}
+
+func TestChallengeResponseConfig_Discover_ok(t *testing.T) {
+	cfg := ChallengeResponseConfig{
+		Client: testDiscoveryClient(t, http.StatusOK, DiscoveryMediaType, testDiscoveryDoc),
+	}
+
+	info, err := cfg.Discover(testBaseURI)
+	require.NoError(t, err)
+	assert.Equal(t, "READY", info.ServiceState)
+
+	assert.Equal(t, testNewSessionURI, cfg.NewSessionURI)
+	assert.False(t, cfg.UseTLS)
+	require.Len(t, cfg.EARKeys, 1)
+	assert.Equal(t, "ES256", cfg.EARKeys[0].Algorithm)
+}
+
+func TestChallengeResponseConfig_Discover_nok(t *testing.T) {
+	notReady := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(testDiscoveryDoc), &notReady))
+	notReady["service-state"] = "DOWN"
+	notReadyDoc, err := json.Marshal(notReady)
+	require.NoError(t, err)
+
+	for _, tv := range []struct {
+		base string
+		doc  string
+		err  string
+	}{
+		{testBaseURI, string(notReadyDoc), `verification service is not ready (state: "DOWN")`},
+		{
+			testBaseURI,
+			`{"service-state": "READY", "api-endpoints": {}}`,
+			`endpoint "newChallengeResponseSession" not advertised by the service`,
+		},
+		{
+			testBaseURI,
+			`{"service-state": "READY", "api-endpoints": {"newChallengeResponseSession": "/new"}, "ear-verification-key": {"kty": "oct"}}`,
+			`parsing EAR verification key: unsupported key type "oct"`,
+		},
+		{"/relative", testDiscoveryDoc, "the supplied base URI is not in absolute form"},
+	} {
+		cfg := ChallengeResponseConfig{
+			Client: testDiscoveryClient(t, http.StatusOK, DiscoveryMediaType, tv.doc),
+		}
+
+		_, err := cfg.Discover(tv.base)
+		assert.EqualError(t, err, tv.err)
+	}
+}
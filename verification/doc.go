@@ -47,6 +47,26 @@ or just the size of a nonce to be provided by the server side:
 		NewSessionURI:   "http://veraison.example/challenge-response/v1/newSession",
 	}
 
+Instead of a hand-written NewSessionURI, the endpoint (and the EAR
+verification key) can be discovered from the base URL of the verification
+service, which fetches its /.well-known/veraison/verification document:
+
+	cfg := ChallengeResponseConfig{
+		NonceSz:         32,
+		EvidenceBuilder: MyEvidenceBuilder{...},
+	}
+
+	info, err := cfg.Discover("https://veraison.example:8443")
+	if err != nil {
+		// handle error
+	}
+
+	if !info.SupportsMediaType("application/my-evidence-media-type") {
+		// the service cannot appraise our Evidence
+	}
+
+The discovery document can also be fetched on its own via GetServiceInfo.
+
 The user can also supply a custom Client object, for example to appropriately
 configure the underlying TLS transport:
 
@@ -61,6 +81,21 @@ server instead of letting it expire:
 
 	cfg.DeleteSession = true
 
+If the server processes the Evidence asynchronously, the session resource is
+polled according to common.DefaultPollPolicy. A different PollPolicy can be
+supplied, for example to wait longer for slow verifiers:
+
+	err := cfg.SetPollPolicy(common.PollPolicy{
+		InitialDelay: 2 * time.Second,
+		MaxDelay:     15 * time.Second,
+		Multiplier:   1.5,
+		Jitter:       0.2,
+		Deadline:     5 * time.Minute,
+	})
+
+Any Retry-After header returned by the server takes precedence over the
+computed delay.
+
 Then the Run method is invoked on the instantiated ChallengeReponseConfig
 object to trigger the protocol FSM, hiding any details about the synchronus /
 async nature of the underlying exchange:
@@ -73,6 +108,53 @@ On success, the Attestation Result, is returned as a JSON string:
 		fmt.Println(string(attestationResult))
 	}
 
+RunContext can be used instead of Run to bind the exchange, including any wait
+between polls of the session resource, to a context.Context:
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	attestationResult, err := cfg.RunContext(ctx)
+
+Veraison returns the Attestation Result as an EAT Attestation Result (EAR).
+RunEAR (and RunEARContext) decode it into an ear.AttestationResult:
+
+	res, err := cfg.RunEAR()
+	if err == nil {
+		fmt.Println(res.Status())
+	}
+
+The signature of the EAR is only checked if the verifier's public key is
+configured, either explicitly via SetEARKeys / SetEARKeysFile, or by fetching
+the key advertised in the service's well-known discovery document:
+
+	if err := cfg.DiscoverEARKeys(); err != nil {
+		// handle error
+	}
+
+	res, err := cfg.RunEAR()
+
+	var verr *ear.VerificationError
+	if errors.As(err, &verr) {
+		// the EAR was not signed by the expected verifier
+	}
+
+To protect against replayed results, the session resource must carry the
+requested nonce (or one of the requested size), and the EAR returned by RunEAR
+must carry the session nonce in its "eat_nonce" claim and have been issued
+within the last MaxResultAge (DefaultMaxResultAge if unset), give or take
+ClockSkew (DefaultClockSkew if unset):
+
+	err := cfg.SetMaxResultAge(time.Minute)
+
+Note that Run only checks the nonce of the session resource: since it does
+not interpret the Attestation Result, the result itself is only checked for
+freshness by RunEAR.
+
+These checks can be disabled with:
+
+	cfg.SetSkipFreshness(true)
+
 # Challenge-Response, split operation
 
 Using this mode of operation the client is responsible for dealing with each
@@ -0,0 +1,35 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+Package apiclient/verification/ear decodes the EAT Attestation Results (EAR)
+returned by Veraison at the end of a challenge-response exchange. See
+https://datatracker.ietf.org/doc/draft-fv-rats-ear/ for the format.
+
+An EAR is a JWT whose claims set describes the appraisal of each submitted
+Evidence component ("submod"), including its overall trust tier and its AR4SI
+trustworthiness vector:
+
+	res, err := cfg.RunEAR()
+	if err != nil {
+		// handle error
+	}
+
+	for name, appraisal := range res.Submods {
+		fmt.Printf("%s: %s\n", name, appraisal.Status)
+	}
+
+Decode does not check the signature of the JWT. Verify does, using the
+supplied public keys (see ParseJWK, ParseJWKS and LoadKeys); the ES256, ES384,
+EdDSA and PS256 algorithms are supported:
+
+	keys, err := ear.LoadKeys("verifier-key.jwk")
+	if err != nil {
+		// handle error
+	}
+
+	res, err := ear.Verify(data, keys)
+
+A failed signature check is reported as a *VerificationError.
+*/
+package ear
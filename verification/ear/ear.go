@@ -0,0 +1,209 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Profiles are the EAR profiles recognised by Decode
+var Profiles = []string{
+	"tag:github.com,2023:veraison/ear",
+	"tag:github.com,2022:veraison/ear",
+}
+
+// AttestationResult is the claims set of an EAR
+type AttestationResult struct {
+	Profile    string                `json:"eat_profile"`
+	IssuedAt   int64                 `json:"iat"`
+	Issuer     string                `json:"iss,omitempty"`
+	Nonce      string                `json:"eat_nonce,omitempty"`
+	VerifierID *VerifierIdentity     `json:"ear.verifier-id,omitempty"`
+	Submods    map[string]*Appraisal `json:"submods"`
+}
+
+// VerifierIdentity identifies the verifier that produced the EAR
+type VerifierIdentity struct {
+	Build     string `json:"build"`
+	Developer string `json:"developer"`
+}
+
+// Appraisal is the outcome of the appraisal of one Evidence component
+type Appraisal struct {
+	Status            TrustTier              `json:"ear.status"`
+	TrustVector       *TrustVector           `json:"ear.trustworthiness-vector,omitempty"`
+	PolicyID          string                 `json:"ear.appraisal-policy-id,omitempty"`
+	AnnotatedEvidence map[string]interface{} `json:"ear.veraison.annotated-evidence,omitempty"`
+	PolicyClaims      map[string]interface{} `json:"ear.veraison.policy-claims,omitempty"`
+}
+
+// IssuedAtTime returns the "iat" claim as a time.Time
+func (o AttestationResult) IssuedAtTime() time.Time {
+	return time.Unix(o.IssuedAt, 0)
+}
+
+// Status returns the least favourable TrustTier across all submods. A submod
+// with no verdict (TrustTierNone) is less favourable than an affirming one,
+// so that the result is only affirming if every submod is. TrustTierNone is
+// returned if there are no submods.
+func (o AttestationResult) Status() TrustTier {
+	if len(o.Submods) == 0 {
+		return TrustTierNone
+	}
+
+	status := TrustTierAffirming
+
+	for _, a := range o.Submods {
+		tier := TrustTierNone
+		if a != nil {
+			tier = a.Status
+		}
+
+		if tierRank(tier) > tierRank(status) {
+			status = tier
+		}
+	}
+
+	return status
+}
+
+// tierRank orders trust tiers from the most to the least favourable:
+// affirming, none, warning, contraindicated. Unknown tiers rank by value
+// alongside the others.
+func tierRank(t TrustTier) int {
+	switch t {
+	case TrustTierAffirming:
+		return 0
+	case TrustTierNone:
+		return 1
+	}
+	return int(t)
+}
+
+// Validate checks that the mandatory EAR claims are present
+func (o AttestationResult) Validate() error {
+	if !isKnownProfile(o.Profile) {
+		return fmt.Errorf("unsupported EAR profile %q", o.Profile)
+	}
+
+	if o.IssuedAt == 0 {
+		return errors.New(`missing "iat" claim`)
+	}
+
+	if len(o.Submods) == 0 {
+		return errors.New(`missing "submods" claim`)
+	}
+
+	for name, a := range o.Submods {
+		if a == nil {
+			return fmt.Errorf("empty appraisal for submod %q", name)
+		}
+	}
+
+	return nil
+}
+
+func isKnownProfile(profile string) bool {
+	for _, p := range Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode parses and validates the EAR in data, without checking its
+// signature. data is either the compact serialization of the JWT or a JSON
+// string wrapping it, as found in the "result" member of a challenge-response
+// session.
+func Decode(data []byte) (*AttestationResult, error) {
+	token, err := ExtractJWT(data)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeClaims(jwt.payload)
+}
+
+// ExtractJWT returns the compact serialization of the JWT in data, which is
+// either the bare JWT or a JSON string wrapping it
+func ExtractJWT(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) == 0 {
+		return "", errors.New("empty attestation result")
+	}
+
+	if data[0] != '"' {
+		return string(data), nil
+	}
+
+	var token string
+
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("decoding attestation result: %w", err)
+	}
+
+	return token, nil
+}
+
+func decodeClaims(payload []byte) (*AttestationResult, error) {
+	var ar AttestationResult
+
+	if err := json.Unmarshal(payload, &ar); err != nil {
+		return nil, fmt.Errorf("decoding EAR claims: %w", err)
+	}
+
+	if err := ar.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid EAR: %w", err)
+	}
+
+	return &ar, nil
+}
+
+// jwt is a JWS in compact serialization, split into its parts
+type jwt struct {
+	header       []byte
+	payload      []byte
+	signature    []byte
+	signingInput string
+}
+
+func parseJWT(token string) (*jwt, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT: expecting 3 parts, got %d", len(parts))
+	}
+
+	var (
+		o   jwt
+		err error
+	)
+
+	if o.header, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+
+	if o.payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %w", err)
+	}
+
+	if o.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, fmt.Errorf("malformed JWT signature: %w", err)
+	}
+
+	o.signingInput = parts[0] + "." + parts[1]
+
+	return &o, nil
+}
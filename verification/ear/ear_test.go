@@ -0,0 +1,192 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testClaims = `{
+	"eat_profile": "tag:github.com,2023:veraison/ear",
+	"iat": 1666091373,
+	"iss": "veraison",
+	"eat_nonce": "3q2-7w",
+	"ear.verifier-id": {
+		"build": "N/A",
+		"developer": "Veraison Project"
+	},
+	"submods": {
+		"PSA_IOT": {
+			"ear.status": "affirming",
+			"ear.trustworthiness-vector": {
+				"instance-identity": 2,
+				"configuration": 0,
+				"executables": 33,
+				"hardware": 2
+			},
+			"ear.appraisal-policy-id": "policy:PSA_IOT",
+			"ear.veraison.annotated-evidence": {
+				"psa-instance-id": "AQID"
+			},
+			"ear.veraison.policy-claims": {
+				"sw-name": "BL"
+			}
+		},
+		"CCA_REALM": {
+			"ear.status": "warning"
+		}
+	}
+}`
+
+func makeTestJWT(t *testing.T, claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	signature := base64.RawURLEncoding.EncodeToString([]byte("signature"))
+
+	return header + "." + payload + "." + signature
+}
+
+func TestDecode_ok(t *testing.T) {
+	token := makeTestJWT(t, testClaims)
+	wrapped, err := json.Marshal(token)
+	require.NoError(t, err)
+
+	for _, data := range [][]byte{[]byte(token), wrapped} {
+		ar, err := Decode(data)
+		require.NoError(t, err)
+
+		assert.Equal(t, "tag:github.com,2023:veraison/ear", ar.Profile)
+		assert.Equal(t, int64(1666091373), ar.IssuedAt)
+		assert.Equal(t, int64(1666091373), ar.IssuedAtTime().Unix())
+		assert.Equal(t, "veraison", ar.Issuer)
+		assert.Equal(t, "3q2-7w", ar.Nonce)
+		require.NotNil(t, ar.VerifierID)
+		assert.Equal(t, "Veraison Project", ar.VerifierID.Developer)
+		assert.Equal(t, TrustTierWarning, ar.Status())
+
+		require.Contains(t, ar.Submods, "PSA_IOT")
+		psa := ar.Submods["PSA_IOT"]
+		assert.Equal(t, TrustTierAffirming, psa.Status)
+		assert.Equal(t, "policy:PSA_IOT", psa.PolicyID)
+		assert.Equal(t, "AQID", psa.AnnotatedEvidence["psa-instance-id"])
+		assert.Equal(t, "BL", psa.PolicyClaims["sw-name"])
+
+		require.NotNil(t, psa.TrustVector)
+		assert.Equal(t, map[string]TrustClaim{
+			"instance-identity": 2,
+			"configuration":     0,
+			"executables":       33,
+			"hardware":          2,
+		}, psa.TrustVector.Claims())
+		assert.Nil(t, psa.TrustVector.FileSystem)
+	}
+}
+
+func TestDecode_nok(t *testing.T) {
+	for _, tv := range []struct {
+		data string
+		err  string
+	}{
+		{"", "empty attestation result"},
+		{`"unterminated`, "decoding attestation result: unexpected end of JSON input"},
+		{"a.b", "malformed JWT: expecting 3 parts, got 2"},
+		{"!.e30.", "malformed JWT header: illegal base64 data at input byte 0"},
+		{makeTestJWT(t, `[]`), "decoding EAR claims: json: cannot unmarshal array into Go value of type ear.AttestationResult"},
+		{makeTestJWT(t, `{"iat": 1}`), `invalid EAR: unsupported EAR profile ""`},
+		{
+			makeTestJWT(t, `{"eat_profile": "tag:github.com,2023:veraison/ear", "submods": {}}`),
+			`invalid EAR: missing "iat" claim`,
+		},
+		{
+			makeTestJWT(t, `{"eat_profile": "tag:github.com,2023:veraison/ear", "iat": 1}`),
+			`invalid EAR: missing "submods" claim`,
+		},
+		{
+			makeTestJWT(t, `{"eat_profile": "tag:github.com,2023:veraison/ear", "iat": 1, "submods": {"a": null}}`),
+			`invalid EAR: empty appraisal for submod "a"`,
+		},
+		{
+			makeTestJWT(t, `{"eat_profile": "tag:github.com,2023:veraison/ear", "iat": 1, "submods": {"a": {"ear.status": "great"}}}`),
+			`decoding EAR claims: unknown trust tier "great"`,
+		},
+	} {
+		_, err := Decode([]byte(tv.data))
+		assert.EqualError(t, err, tv.err, tv.data)
+	}
+}
+
+func TestTrustTier_JSON(t *testing.T) {
+	var tier TrustTier
+
+	require.NoError(t, json.Unmarshal([]byte(`"contraindicated"`), &tier))
+	assert.Equal(t, TrustTierContraindicated, tier)
+
+	require.NoError(t, json.Unmarshal([]byte(`32`), &tier))
+	assert.Equal(t, TrustTierWarning, tier)
+
+	assert.EqualError(t, json.Unmarshal([]byte(`33`), &tier), "unknown trust tier 33")
+	assert.EqualError(t, json.Unmarshal([]byte(`true`), &tier), "trust tier must be a string or a number, got bool")
+
+	data, err := json.Marshal(TrustTierAffirming)
+	require.NoError(t, err)
+	assert.Equal(t, `"affirming"`, string(data))
+
+	_, err = json.Marshal(TrustTier(5))
+	assert.ErrorContains(t, err, "invalid trust tier 5")
+
+	assert.Equal(t, "none", TrustTierNone.String())
+	assert.Equal(t, "TrustTier(5)", TrustTier(5).String())
+}
+
+func TestTrustClaim_Tier(t *testing.T) {
+	for _, tv := range []struct {
+		claim TrustClaim
+		tier  TrustTier
+	}{
+		{0, TrustTierNone},
+		{-1, TrustTierNone},
+		{2, TrustTierAffirming},
+		{-32, TrustTierAffirming},
+		{32, TrustTierWarning},
+		{-96, TrustTierWarning},
+		{96, TrustTierContraindicated},
+		{-128, TrustTierContraindicated},
+	} {
+		assert.Equal(t, tv.tier, tv.claim.Tier(), "claim %d", tv.claim)
+	}
+}
+
+func TestAttestationResult_Status(t *testing.T) {
+	for _, tv := range []struct {
+		tiers    []TrustTier
+		expected TrustTier
+	}{
+		{nil, TrustTierNone},
+		{[]TrustTier{TrustTierAffirming}, TrustTierAffirming},
+		{[]TrustTier{TrustTierAffirming, TrustTierNone}, TrustTierNone},
+		{[]TrustTier{TrustTierNone, TrustTierWarning}, TrustTierWarning},
+		{[]TrustTier{TrustTierAffirming, TrustTierContraindicated, TrustTierWarning}, TrustTierContraindicated},
+	} {
+		ar := AttestationResult{Submods: map[string]*Appraisal{}}
+		for i, tier := range tv.tiers {
+			ar.Submods[fmt.Sprintf("submod-%d", i)] = &Appraisal{Status: tier}
+		}
+
+		assert.Equal(t, tv.expected, ar.Status(), "%v", tv.tiers)
+	}
+}
+
+func TestAttestationResult_Status_nil_appraisal(t *testing.T) {
+	ar := AttestationResult{Submods: map[string]*Appraisal{
+		"submod-0": {Status: TrustTierAffirming},
+		"submod-1": nil,
+	}}
+
+	assert.Equal(t, TrustTierNone, ar.Status())
+}
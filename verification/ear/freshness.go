@@ -0,0 +1,61 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNonceMismatch is returned by CheckNonce if the EAR is not bound to
+	// the expected nonce
+	ErrNonceMismatch = errors.New("EAR nonce does not match")
+
+	// ErrStaleResult is returned by CheckFreshness if the EAR was issued
+	// too long ago, or in the future
+	ErrStaleResult = errors.New("EAR is not fresh")
+)
+
+// CheckNonce checks that the "eat_nonce" claim carries the supplied nonce.
+// The claim may use any of the base64 alphabets, with or without padding.
+func (o AttestationResult) CheckNonce(nonce []byte) error {
+	if o.Nonce == "" {
+		return fmt.Errorf(`%w: missing "eat_nonce" claim`, ErrNonceMismatch)
+	}
+
+	for _, enc := range []*base64.Encoding{
+		base64.RawURLEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.StdEncoding,
+	} {
+		if v, err := enc.DecodeString(o.Nonce); err == nil && bytes.Equal(v, nonce) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: got %q", ErrNonceMismatch, o.Nonce)
+}
+
+// CheckFreshness checks that the EAR was issued no more than maxAge before
+// now, tolerating a clock skew of up to skew in either direction
+func (o AttestationResult) CheckFreshness(now time.Time, maxAge, skew time.Duration) error {
+	iat := o.IssuedAtTime()
+
+	if iat.After(now.Add(skew)) {
+		return fmt.Errorf("%w: issued in the future (%s)", ErrStaleResult, iat.UTC().Format(time.RFC3339))
+	}
+
+	if age := now.Sub(iat); age > maxAge+skew {
+		return fmt.Errorf(
+			"%w: issued %s ago, maximum age is %s",
+			ErrStaleResult, age.Round(time.Second), maxAge,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttestationResult_CheckNonce(t *testing.T) {
+	nonce := []byte{0xde, 0xad, 0xbe, 0xef, 0xfb}
+
+	for _, enc := range []string{"3q2-7_s", "3q2-7_s=", "3q2+7/s", "3q2+7/s="} {
+		assert.NoError(t, AttestationResult{Nonce: enc}.CheckNonce(nonce), enc)
+	}
+
+	err := AttestationResult{Nonce: "AAAA"}.CheckNonce(nonce)
+	assert.EqualError(t, err, `EAR nonce does not match: got "AAAA"`)
+	assert.ErrorIs(t, err, ErrNonceMismatch)
+
+	err = AttestationResult{}.CheckNonce(nonce)
+	assert.EqualError(t, err, `EAR nonce does not match: missing "eat_nonce" claim`)
+}
+
+func TestAttestationResult_CheckFreshness(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	maxAge := 5 * time.Minute
+	skew := 30 * time.Second
+
+	for _, tv := range []struct {
+		iat int64
+		err string
+	}{
+		{now.Unix(), ""},
+		{now.Unix() - 300, ""},
+		{now.Unix() - 330, ""},
+		{now.Unix() + 30, ""},
+		{now.Unix() - 331, "EAR is not fresh: issued 5m31s ago, maximum age is 5m0s"},
+		{now.Unix() + 31, "EAR is not fresh: issued in the future (2023-11-14T22:13:51Z)"},
+	} {
+		err := AttestationResult{IssuedAt: tv.iat}.CheckFreshness(now, maxAge, skew)
+		if tv.err == "" {
+			assert.NoError(t, err, tv.iat)
+		} else {
+			assert.EqualError(t, err, tv.err)
+			assert.ErrorIs(t, err, ErrStaleResult)
+		}
+	}
+}
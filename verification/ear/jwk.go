@@ -0,0 +1,192 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key is a public key used to verify the signature of EARs
+type Key struct {
+	KeyID     string           // optional, matched against the "kid" header parameter
+	Algorithm string           // optional, matched against the "alg" header parameter
+	Public    crypto.PublicKey // *ecdsa.PublicKey, ed25519.PublicKey or *rsa.PublicKey
+}
+
+// jwk is the subset of RFC 7517 JSON Web Key members used for public keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// ParseJWK decodes a JSON Web Key (RFC 7517) holding an EC (P-256 or P-384),
+// OKP (Ed25519) or RSA public key
+func ParseJWK(data []byte) (*Key, error) {
+	var j jwk
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("decoding JWK: %w", err)
+	}
+
+	return j.toKey()
+}
+
+// ParseJWKS decodes a JSON Web Key Set (RFC 7517, Section 5)
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, errors.New("no keys found in JWKS")
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+
+	for i, j := range set.Keys {
+		k, err := j.toKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key at index %d: %w", i, err)
+		}
+		keys = append(keys, *k)
+	}
+
+	return keys, nil
+}
+
+// LoadKeys reads the EAR verification keys from the file at path, which may
+// contain a JWK, a JWKS or a PEM-encoded SubjectPublicKeyInfo
+func LoadKeys(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading EAR verification keys: %w", err)
+	}
+
+	data = bytes.TrimSpace(data)
+
+	if block, _ := pem.Decode(data); block != nil {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key in %s: %w", path, err)
+		}
+		return []Key{{Public: pub}}, nil
+	}
+
+	var probe map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%s is neither a PEM public key nor a JWK(S): %w", path, err)
+	}
+
+	if _, ok := probe["keys"]; ok {
+		return ParseJWKS(data)
+	}
+
+	k, err := ParseJWK(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Key{*k}, nil
+}
+
+func (o jwk) toKey() (*Key, error) {
+	k := Key{KeyID: o.Kid, Algorithm: o.Alg}
+
+	switch o.Kty {
+	case "EC":
+		var crv elliptic.Curve
+
+		switch o.Crv {
+		case "P-256":
+			crv = elliptic.P256()
+		case "P-384":
+			crv = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", o.Crv)
+		}
+
+		x, err := decodeBigInt("x", o.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt("y", o.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !crv.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", o.Crv)
+		}
+
+		k.Public = &ecdsa.PublicKey{Curve: crv, X: x, Y: y}
+	case "OKP":
+		if o.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", o.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(o.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New(`invalid Ed25519 "x" member`)
+		}
+
+		k.Public = ed25519.PublicKey(x)
+	case "RSA":
+		n, err := decodeBigInt("n", o.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt("e", o.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New(`invalid RSA "e" member`)
+		}
+
+		k.Public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", o.Kty)
+	}
+
+	return &k, nil
+}
+
+func decodeBigInt(name, v string) (*big.Int, error) {
+	if v == "" {
+		return nil, fmt.Errorf("missing %q member", name)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %q member: %w", name, err)
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
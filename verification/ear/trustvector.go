@@ -0,0 +1,126 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TrustTier is the overall verdict on an appraised attester, as conveyed by
+// the "ear.status" claim
+type TrustTier int8
+
+const (
+	TrustTierNone            TrustTier = 0
+	TrustTierAffirming       TrustTier = 2
+	TrustTierWarning         TrustTier = 32
+	TrustTierContraindicated TrustTier = 96
+)
+
+var trustTierNames = map[TrustTier]string{
+	TrustTierNone:            "none",
+	TrustTierAffirming:       "affirming",
+	TrustTierWarning:         "warning",
+	TrustTierContraindicated: "contraindicated",
+}
+
+func (o TrustTier) String() string {
+	if s, ok := trustTierNames[o]; ok {
+		return s
+	}
+	return fmt.Sprintf("TrustTier(%d)", int8(o))
+}
+
+// MarshalJSON encodes the TrustTier using its name
+func (o TrustTier) MarshalJSON() ([]byte, error) {
+	s, ok := trustTierNames[o]
+	if !ok {
+		return nil, fmt.Errorf("invalid trust tier %d", int8(o))
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON decodes a TrustTier from either its name or its numeric value
+func (o *TrustTier) UnmarshalJSON(data []byte) error {
+	var v interface{}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case string:
+		for tier, name := range trustTierNames {
+			if name == t {
+				*o = tier
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown trust tier %q", t)
+	case float64:
+		tier := TrustTier(t)
+		if _, ok := trustTierNames[tier]; !ok || float64(tier) != t {
+			return fmt.Errorf("unknown trust tier %v", t)
+		}
+		*o = tier
+		return nil
+	default:
+		return fmt.Errorf("trust tier must be a string or a number, got %T", v)
+	}
+}
+
+// TrustClaim is the value of one component of an AR4SI trustworthiness
+// vector, in the range [-128, 127]
+type TrustClaim int8
+
+// Tier returns the TrustTier a TrustClaim value falls into
+func (o TrustClaim) Tier() TrustTier {
+	switch {
+	case o >= -1 && o <= 1:
+		return TrustTierNone
+	case (o >= -32 && o <= -2) || (o >= 2 && o <= 31):
+		return TrustTierAffirming
+	case (o >= -96 && o <= -33) || (o >= 32 && o <= 95):
+		return TrustTierWarning
+	default:
+		return TrustTierContraindicated
+	}
+}
+
+// TrustVector is the AR4SI trustworthiness vector conveyed by the
+// "ear.trustworthiness-vector" claim. Components that are not reported by
+// the verifier are left nil.
+type TrustVector struct {
+	InstanceIdentity *TrustClaim `json:"instance-identity,omitempty"`
+	Configuration    *TrustClaim `json:"configuration,omitempty"`
+	Executables      *TrustClaim `json:"executables,omitempty"`
+	FileSystem       *TrustClaim `json:"file-system,omitempty"`
+	Hardware         *TrustClaim `json:"hardware,omitempty"`
+	RuntimeOpaque    *TrustClaim `json:"runtime-opaque,omitempty"`
+	StorageOpaque    *TrustClaim `json:"storage-opaque,omitempty"`
+	SourcedData      *TrustClaim `json:"sourced-data,omitempty"`
+}
+
+// Claims returns the reported components of the vector, keyed by their
+// AR4SI name
+func (o TrustVector) Claims() map[string]TrustClaim {
+	claims := map[string]TrustClaim{}
+
+	for name, c := range map[string]*TrustClaim{
+		"instance-identity": o.InstanceIdentity,
+		"configuration":     o.Configuration,
+		"executables":       o.Executables,
+		"file-system":       o.FileSystem,
+		"hardware":          o.Hardware,
+		"runtime-opaque":    o.RuntimeOpaque,
+		"storage-opaque":    o.StorageOpaque,
+		"sourced-data":      o.SourcedData,
+	} {
+		if c != nil {
+			claims[name] = *c
+		}
+	}
+
+	return claims
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/veraison/apiclient/internal/jws"
+)
+
+// SupportedAlgorithms are the JWS algorithms accepted by Verify
+var SupportedAlgorithms = jws.Algorithms
+
+var (
+	// ErrNoVerificationKey is returned (wrapped in a VerificationError) when
+	// Verify is called without keys
+	ErrNoVerificationKey = errors.New("no verification key supplied")
+
+	// ErrSignatureMismatch is returned (wrapped in a VerificationError) when
+	// the signature does not verify with any of the candidate keys
+	ErrSignatureMismatch = errors.New("signature does not match")
+)
+
+// VerificationError is returned by Verify if the signature of the EAR cannot
+// be verified. Use errors.As to tell it apart from decoding errors.
+type VerificationError struct {
+	Err error
+}
+
+func (o *VerificationError) Error() string {
+	return "EAR signature verification failed: " + o.Err.Error()
+}
+
+func (o *VerificationError) Unwrap() error {
+	return o.Err
+}
+
+// Verify checks the signature of the EAR in data using the supplied keys and,
+// if successful, decodes and validates it as Decode does. The signature is
+// accepted if it verifies with any of the keys whose KeyID and Algorithm (if
+// set) match the JWS header.
+func Verify(data []byte, keys []Key) (*AttestationResult, error) {
+	token, err := ExtractJWT(data)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := json.Unmarshal(jwt.header, &hdr); err != nil {
+		return nil, fmt.Errorf("decoding JWT header: %w", err)
+	}
+
+	if err := verifySignature(jwt, hdr.Alg, hdr.Kid, keys); err != nil {
+		return nil, &VerificationError{Err: err}
+	}
+
+	return decodeClaims(jwt.payload)
+}
+
+func verifySignature(jwt *jwt, alg, kid string, keys []Key) error {
+	if len(keys) == 0 {
+		return ErrNoVerificationKey
+	}
+
+	if !jws.IsSupported(alg) {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	candidates := 0
+
+	for _, k := range keys {
+		if (k.KeyID != "" && kid != "" && k.KeyID != kid) ||
+			(k.Algorithm != "" && k.Algorithm != alg) {
+			continue
+		}
+
+		ok, compatible := jws.Verify(alg, k.Public, jwt.signingInput, jwt.signature)
+		if !compatible {
+			continue
+		}
+
+		if ok {
+			return nil
+		}
+
+		candidates++
+	}
+
+	if candidates == 0 {
+		return fmt.Errorf("no key suitable for algorithm %q", alg)
+	}
+
+	return ErrSignatureMismatch
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+package ear
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestJWT(t *testing.T, alg, kid string, key crypto.Signer, claims string) string {
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	require.NoError(t, err)
+
+	input := base64.RawURLEncoding.EncodeToString(hdr) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	var sig []byte
+
+	switch alg {
+	case "ES256", "ES384":
+		var digest []byte
+		if alg == "ES256" {
+			d := sha256.Sum256([]byte(input))
+			digest = d[:]
+		} else {
+			d := sha512.Sum384([]byte(input))
+			digest = d[:]
+		}
+		k := key.(*ecdsa.PrivateKey)
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		require.NoError(t, err)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	case "EdDSA":
+		sig = ed25519.Sign(key.(ed25519.PrivateKey), []byte(input))
+	case "PS256":
+		d := sha256.Sum256([]byte(input))
+		sig, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, d[:],
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		require.NoError(t, err)
+	default:
+		sig = []byte("signature")
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestVerify_algorithms(t *testing.T) {
+	ec256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ec384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, tv := range []struct {
+		alg string
+		key crypto.Signer
+	}{
+		{"ES256", ec256},
+		{"ES384", ec384},
+		{"EdDSA", ed},
+		{"PS256", rsaKey},
+	} {
+		token := signTestJWT(t, tv.alg, "", tv.key, testClaims)
+
+		ar, err := Verify([]byte(token), []Key{{Public: tv.key.Public()}})
+		require.NoError(t, err, tv.alg)
+		assert.Equal(t, "veraison", ar.Issuer, tv.alg)
+
+		// tampered signature
+		tampered := token[:len(token)-4] + "AAAA"
+		_, err = Verify([]byte(tampered), []Key{{Public: tv.key.Public()}})
+		assert.ErrorIs(t, err, ErrSignatureMismatch, tv.alg)
+	}
+}
+
+func TestVerify_key_selection(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	token := []byte(signTestJWT(t, "ES256", "k2", signer, testClaims))
+
+	// the right key is found among others
+	_, err = Verify(token, []Key{
+		{Public: ed.Public()},
+		{KeyID: "k1", Public: other.Public()},
+		{KeyID: "k2", Algorithm: "ES256", Public: signer.Public()},
+	})
+	assert.NoError(t, err)
+
+	// the key id does not match
+	_, err = Verify(token, []Key{{KeyID: "k1", Public: signer.Public()}})
+	assert.EqualError(t, err, `EAR signature verification failed: no key suitable for algorithm "ES256"`)
+
+	// the key is for a different algorithm
+	_, err = Verify(token, []Key{{Algorithm: "ES384", Public: signer.Public()}})
+	assert.EqualError(t, err, `EAR signature verification failed: no key suitable for algorithm "ES256"`)
+
+	// the key does not match
+	_, err = Verify(token, []Key{{Public: other.Public()}})
+	assert.EqualError(t, err, "EAR signature verification failed: signature does not match")
+
+	var verr *VerificationError
+	assert.True(t, errors.As(err, &verr))
+
+	_, err = Verify(token, nil)
+	assert.ErrorIs(t, err, ErrNoVerificationKey)
+
+	_, err = Verify([]byte(makeTestJWT(t, testClaims)[len("eyJ"):]), []Key{{Public: signer.Public()}})
+	assert.ErrorContains(t, err, "malformed JWT header")
+	assert.False(t, errors.As(err, &verr))
+
+	none := []byte(signTestJWT(t, "none", "", nil, testClaims))
+	_, err = Verify(none, []Key{{Public: signer.Public()}})
+	assert.EqualError(t, err, `EAR signature verification failed: unsupported algorithm "none"`)
+}
+
+func TestParseJWK(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	k, err := ParseJWK([]byte(`{"kty":"EC","crv":"P-256","kid":"ec","alg":"ES256","x":"` +
+		b64(ec.X.FillBytes(make([]byte, 32))) + `","y":"` + b64(ec.Y.FillBytes(make([]byte, 32))) + `"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "ec", k.KeyID)
+	assert.Equal(t, "ES256", k.Algorithm)
+	assert.True(t, ec.PublicKey.Equal(k.Public))
+
+	k, err = ParseJWK([]byte(`{"kty":"OKP","crv":"Ed25519","x":"` + b64(edPub) + `"}`))
+	require.NoError(t, err)
+	assert.Equal(t, edPub, k.Public)
+
+	k, err = ParseJWK([]byte(`{"kty":"RSA","n":"` + b64(rsaKey.N.Bytes()) + `","e":"` +
+		b64(big.NewInt(int64(rsaKey.E)).Bytes()) + `"}`))
+	require.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(k.Public))
+
+	for _, tv := range []struct {
+		jwk string
+		err string
+	}{
+		{`[]`, "decoding JWK: json: cannot unmarshal array into Go value of type ear.jwk"},
+		{`{"kty":"oct"}`, `unsupported key type "oct"`},
+		{`{"kty":"EC","crv":"P-521"}`, `unsupported EC curve "P-521"`},
+		{`{"kty":"EC","crv":"P-256","y":"AA"}`, `missing "x" member`},
+		{`{"kty":"EC","crv":"P-256","x":"AA","y":"AA"}`, "point is not on curve P-256"},
+		{`{"kty":"OKP","crv":"X25519","x":"AA"}`, `unsupported OKP curve "X25519"`},
+		{`{"kty":"OKP","crv":"Ed25519","x":"AA"}`, `invalid Ed25519 "x" member`},
+		{`{"kty":"RSA","n":"AQAB","e":"!"}`, `invalid "e" member: illegal base64 data at input byte 0`},
+	} {
+		_, err := ParseJWK([]byte(tv.jwk))
+		assert.EqualError(t, err, tv.err, tv.jwk)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecJWK := `{"kty":"EC","crv":"P-256","kid":"ec","x":"` +
+		b64(ec.X.FillBytes(make([]byte, 32))) + `","y":"` + b64(ec.Y.FillBytes(make([]byte, 32))) + `"}`
+	edJWK := `{"kty":"OKP","crv":"Ed25519","kid":"ed","x":"` + b64(edPub) + `"}`
+
+	der, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+
+	keys, err := LoadKeys(write("key.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))))
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, ec.PublicKey.Equal(keys[0].Public))
+
+	keys, err = LoadKeys(write("key.jwk", ecJWK))
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "ec", keys[0].KeyID)
+
+	keys, err = LoadKeys(write("keys.jwks", `{"keys":[`+ecJWK+`,`+edJWK+`]}`))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "ed", keys[1].KeyID)
+
+	_, err = LoadKeys(write("empty.jwks", `{"keys":[]}`))
+	assert.EqualError(t, err, "no keys found in JWKS")
+
+	_, err = LoadKeys(write("bad.jwks", `{"keys":[{"kty":"oct"}]}`))
+	assert.EqualError(t, err, `JWKS key at index 0: unsupported key type "oct"`)
+
+	_, err = LoadKeys(write("garbage", "garbage"))
+	assert.ErrorContains(t, err, "is neither a PEM public key nor a JWK(S)")
+
+	_, err = LoadKeys(filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "loading EAR verification keys")
+}